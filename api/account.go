@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/suvpen/suvatp/atperr"
+	"time"
+)
+
+const createAccountNSID = "com.atproto.server.createAccount"
+
+type NewAccount struct {
+	Handle     string
+	Email      string
+	Password   string
+	InviteCode string
+}
+
+func CreateAccount(account *NewAccount, config *Config, opts ...ClientOption) (*ATPClient, error) {
+	return CreateAccountContext(context.Background(), account, config, opts...)
+}
+
+// CreateAccountContext registers an account on config.ATProtoEndpoint and returns a
+// client signed in to it. The session is saved like one created by Client, but the
+// account password is only kept in memory, in place of an app password.
+func CreateAccountContext(
+	ctx context.Context, account *NewAccount, config *Config, opts ...ClientOption) (*ATPClient, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	options := newClientOptions(config, opts)
+
+	atpClient := &ATPClient{
+		Config:      config,
+		AppPassword: account.Password,
+	}
+	options.apply(atpClient)
+	// the account password grants more than an app password and never goes to the store
+	atpClient.omitAppPassword = true
+
+	atpClient.Client = atpClient.attach(&xrpc.Client{Host: config.ATProtoEndpoint})
+
+	input := &atproto.ServerCreateAccount_Input{
+		Handle:   account.Handle,
+		Password: &account.Password,
+	}
+	if account.Email != "" {
+		input.Email = &account.Email
+	}
+	if account.InviteCode != "" {
+		input.InviteCode = &account.InviteCode
+	}
+
+	created, err := atproto.ServerCreateAccount(ctx, atpClient.Client, input)
+	if err != nil {
+		return nil, fmt.Errorf("error creating account %s: %w", account.Handle, atperr.FromError(err, createAccountNSID))
+	}
+
+	atpClient.Did = created.Did
+
+	err = atpClient.startSession(ctx, created.AccessJwt, created.RefreshJwt, created.Handle, created.Did, created.DidDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	return atpClient, nil
+}
+
+func (atpClient *ATPClient) CheckAccountStatus() (*atproto.ServerCheckAccountStatus_Output, error) {
+	return atpClient.CheckAccountStatusContext(context.Background())
+}
+
+func (atpClient *ATPClient) CheckAccountStatusContext(ctx context.Context) (*atproto.ServerCheckAccountStatus_Output, error) {
+	var resp *atproto.ServerCheckAccountStatus_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.ServerCheckAccountStatus(ctx, atpClient.Client)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error checking account status of %s: %w", atpClient.Did, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) DeactivateAccount(deleteAfter time.Time) error {
+	return atpClient.DeactivateAccountContext(context.Background(), deleteAfter)
+}
+
+// DeactivateAccountContext deactivates the account; a non-zero deleteAfter asks the
+// PDS to delete it if it is not activated again by then.
+func (atpClient *ATPClient) DeactivateAccountContext(ctx context.Context, deleteAfter time.Time) error {
+	input := &atproto.ServerDeactivateAccount_Input{}
+	if !deleteAfter.IsZero() {
+		at := deleteAfter.UTC().Format(time.RFC3339)
+		input.DeleteAfter = &at
+	}
+
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.ServerDeactivateAccount(ctx, atpClient.Client, input)
+	})
+	if err != nil {
+		return fmt.Errorf("error deactivating account %s: %w", atpClient.Did, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) ActivateAccount() error {
+	return atpClient.ActivateAccountContext(context.Background())
+}
+
+func (atpClient *ATPClient) ActivateAccountContext(ctx context.Context) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.ServerActivateAccount(ctx, atpClient.Client)
+	})
+	if err != nil {
+		return fmt.Errorf("error activating account %s: %w", atpClient.Did, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) RequestAccountDelete() error {
+	return atpClient.RequestAccountDeleteContext(context.Background())
+}
+
+// RequestAccountDeleteContext has the PDS email the token needed by DeleteAccount.
+func (atpClient *ATPClient) RequestAccountDeleteContext(ctx context.Context) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.ServerRequestAccountDelete(ctx, atpClient.Client)
+	})
+	if err != nil {
+		return fmt.Errorf("error requesting deletion of account %s: %w", atpClient.Did, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) DeleteAccount(password, token string) error {
+	return atpClient.DeleteAccountContext(context.Background(), password, token)
+}
+
+// DeleteAccountContext permanently deletes the account with the token sent by
+// RequestAccountDelete, and removes its stored session.
+func (atpClient *ATPClient) DeleteAccountContext(ctx context.Context, password, token string) error {
+	atpClient.mu.RLock()
+	did := atpClient.Client.Auth.Did
+	atpClient.mu.RUnlock()
+
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.ServerDeleteAccount(ctx, atpClient.Client, &atproto.ServerDeleteAccount_Input{
+			Did:      did,
+			Password: password,
+			Token:    token,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting account %s: %w", atpClient.Did, err)
+	}
+
+	atpClient.mu.Lock()
+	defer atpClient.mu.Unlock()
+
+	if err = atpClient.store.Delete(atpClient.Config.ATProtoEndpoint, atpClient.Did); err != nil {
+		return fmt.Errorf("error removing session of %s: %w", atpClient.Did, err)
+	}
+
+	atpClient.setAuth("", "", "", did)
+
+	return nil
+}
+
+func (atpClient *ATPClient) RequestEmailConfirmation() error {
+	return atpClient.RequestEmailConfirmationContext(context.Background())
+}
+
+func (atpClient *ATPClient) RequestEmailConfirmationContext(ctx context.Context) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.ServerRequestEmailConfirmation(ctx, atpClient.Client)
+	})
+	if err != nil {
+		return fmt.Errorf("error requesting email confirmation of %s: %w", atpClient.Did, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) ConfirmEmail(email, token string) error {
+	return atpClient.ConfirmEmailContext(context.Background(), email, token)
+}
+
+func (atpClient *ATPClient) ConfirmEmailContext(ctx context.Context, email, token string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.ServerConfirmEmail(ctx, atpClient.Client, &atproto.ServerConfirmEmail_Input{
+			Email: email,
+			Token: token,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error confirming email of %s: %w", atpClient.Did, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) RequestEmailUpdate() (bool, error) {
+	return atpClient.RequestEmailUpdateContext(context.Background())
+}
+
+// RequestEmailUpdateContext reports whether UpdateEmail needs a token; if so, the
+// PDS has sent it to the current address.
+func (atpClient *ATPClient) RequestEmailUpdateContext(ctx context.Context) (bool, error) {
+	var resp *atproto.ServerRequestEmailUpdate_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.ServerRequestEmailUpdate(ctx, atpClient.Client)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("error requesting email update of %s: %w", atpClient.Did, err)
+	}
+
+	return resp.TokenRequired, nil
+}
+
+func (atpClient *ATPClient) UpdateEmail(email, token string) error {
+	return atpClient.UpdateEmailContext(context.Background(), email, token)
+}
+
+func (atpClient *ATPClient) UpdateEmailContext(ctx context.Context, email, token string) error {
+	input := &atproto.ServerUpdateEmail_Input{Email: email}
+	if token != "" {
+		input.Token = &token
+	}
+
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.ServerUpdateEmail(ctx, atpClient.Client, input)
+	})
+	if err != nil {
+		return fmt.Errorf("error updating email of %s: %w", atpClient.Did, err)
+	}
+
+	return nil
+}
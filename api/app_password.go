@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/suvpen/suvatp/atperr"
+)
+
+const (
+	createAppPasswordNSID = "com.atproto.server.createAppPassword"
+	revokeAppPasswordNSID = "com.atproto.server.revokeAppPassword"
+)
+
+// App passwords can only be managed from a session signed in with the account
+// password; sessions created with an app password are refused by the PDS.
+
+func (atpClient *ATPClient) CreateAppPassword(name string, privileged bool) (*atproto.ServerCreateAppPassword_AppPassword, error) {
+	return atpClient.CreateAppPasswordContext(context.Background(), name, privileged)
+}
+
+func (atpClient *ATPClient) CreateAppPasswordContext(
+	ctx context.Context, name string, privileged bool) (*atproto.ServerCreateAppPassword_AppPassword, error) {
+	var resp *atproto.ServerCreateAppPassword_AppPassword
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = createAppPassword(ctx, atpClient.Client, name, privileged)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating app password %s: %w", name, err)
+	}
+
+	return resp, nil
+}
+
+// createAppPassword and revokeAppPassword call the PDS with xrpcClient as is, so they
+// can be used with sessions other than the one invoke renews.
+func createAppPassword(
+	ctx context.Context, xrpcClient *xrpc.Client, name string,
+	privileged bool) (*atproto.ServerCreateAppPassword_AppPassword, error) {
+	input := &atproto.ServerCreateAppPassword_Input{Name: name}
+	if privileged {
+		input.Privileged = &privileged
+	}
+
+	return atproto.ServerCreateAppPassword(ctx, xrpcClient, input)
+}
+
+func (atpClient *ATPClient) ListAppPasswords() ([]*atproto.ServerListAppPasswords_AppPassword, error) {
+	return atpClient.ListAppPasswordsContext(context.Background())
+}
+
+func (atpClient *ATPClient) ListAppPasswordsContext(ctx context.Context) ([]*atproto.ServerListAppPasswords_AppPassword, error) {
+	var resp *atproto.ServerListAppPasswords_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.ServerListAppPasswords(ctx, atpClient.Client)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing app passwords of %s: %w", atpClient.Did, err)
+	}
+
+	return resp.Passwords, nil
+}
+
+func (atpClient *ATPClient) RevokeAppPassword(name string) error {
+	return atpClient.RevokeAppPasswordContext(context.Background(), name)
+}
+
+// RevokeAppPasswordContext revokes the app password and every session created with it.
+func (atpClient *ATPClient) RevokeAppPasswordContext(ctx context.Context, name string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return revokeAppPassword(ctx, atpClient.Client, name)
+	})
+	if err != nil {
+		return fmt.Errorf("error revoking app password %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func revokeAppPassword(ctx context.Context, xrpcClient *xrpc.Client, name string) error {
+	return atproto.ServerRevokeAppPassword(ctx, xrpcClient, &atproto.ServerRevokeAppPassword_Input{Name: name})
+}
+
+func (atpClient *ATPClient) RotateAppPassword(
+	accountPassword, oldName, newName string) (*atproto.ServerCreateAppPassword_AppPassword, error) {
+	return atpClient.RotateAppPasswordContext(context.Background(), accountPassword, oldName, newName)
+}
+
+// RotateAppPasswordContext replaces the app password atpClient signs in with. Using a
+// temporary session signed in with the account password, it creates newName, signs
+// atpClient in again with it and saves the session, then revokes oldName (skipped when
+// empty) and ends the temporary session. The new password is returned so it can be
+// stored wherever the old one came from.
+func (atpClient *ATPClient) RotateAppPasswordContext(
+	ctx context.Context, accountPassword, oldName, newName string) (*atproto.ServerCreateAppPassword_AppPassword, error) {
+	atpClient.mu.RLock()
+	unauthenticated := *atpClient.Client
+	atpClient.mu.RUnlock()
+	unauthenticated.Auth = nil
+
+	fullSession, err := signIn(ctx, &unauthenticated, atpClient.Did, accountPassword, "", atpClient.authFactorPrompt)
+	if err != nil {
+		return nil, fmt.Errorf("error rotating app password of %s: %w", atpClient.Did, err)
+	}
+
+	manager := unauthenticated
+	manager.Auth = &xrpc.AuthInfo{
+		AccessJwt:  fullSession.AccessJwt,
+		RefreshJwt: fullSession.RefreshJwt,
+		Handle:     fullSession.Handle,
+		Did:        fullSession.Did,
+	}
+	defer func() {
+		refreshClient := manager
+		refreshClient.Auth = &xrpc.AuthInfo{AccessJwt: manager.Auth.RefreshJwt}
+		_ = atproto.ServerDeleteSession(ctx, &refreshClient)
+	}()
+
+	// the temporary session is fresh, so its calls skip invoke and its renewal of atpClient
+	appPassword, err := createAppPassword(ctx, &manager, newName, false)
+	if err != nil {
+		return nil, fmt.Errorf("error rotating app password of %s: %w",
+			atpClient.Did, atperr.FromError(err, createAppPasswordNSID))
+	}
+
+	session, err := signIn(ctx, &unauthenticated, atpClient.Did, appPassword.Password, "", atpClient.authFactorPrompt)
+	if err != nil {
+		return appPassword, fmt.Errorf("error signing in with app password %s: %w", newName, err)
+	}
+
+	atpClient.mu.Lock()
+	atpClient.setAuth(session.AccessJwt, session.RefreshJwt, session.Handle, session.Did)
+	atpClient.AppPassword = appPassword.Password
+	err = atpClient.saveSession()
+	atpClient.mu.Unlock()
+
+	if err != nil {
+		return appPassword, err
+	}
+
+	if oldName != "" && oldName != newName {
+		if err = revokeAppPassword(ctx, &manager, oldName); err != nil {
+			err = fmt.Errorf("error revoking app password %s: %w", oldName, atperr.FromError(err, revokeAppPasswordNSID))
+			return appPassword, errors.Join(fmt.Errorf("app password rotated to %s", newName), err)
+		}
+	}
+
+	return appPassword, nil
+}
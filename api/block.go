@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/suvpen/suvatp/identity"
+	"github.com/suvpen/suvatp/util"
+	"iter"
+	"time"
+)
+
+// maxWritesPerApplyWrites is the most writes a PDS accepts in one com.atproto.repo.applyWrites.
+const maxWritesPerApplyWrites = 200
+
+func (atpClient *ATPClient) GetBlocks(cursor string, limit int64) (*bsky.GraphGetBlocks_Output, error) {
+	return atpClient.GetBlocksContext(context.Background(), cursor, limit)
+}
+
+func (atpClient *ATPClient) GetBlocksContext(ctx context.Context, cursor string, limit int64) (*bsky.GraphGetBlocks_Output, error) {
+	var resp *bsky.GraphGetBlocks_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.GraphGetBlocks(ctx, atpClient.Client, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting blocks: %w", err)
+	}
+
+	return resp, nil
+}
+
+// GetBlocksIter pages through the profiles of blocked accounts. Deleted and taken
+// down accounts are left out; ListBlockRecordsIter sees every block.
+func (atpClient *ATPClient) GetBlocksIter(ctx context.Context, opts *PageOptions) iter.Seq2[*bsky.ActorDefs_ProfileView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.ActorDefs_ProfileView, *string, error) {
+			resp, err := atpClient.GetBlocksContext(ctx, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Blocks, resp.Cursor, nil
+		})
+}
+
+// BlockRecord is a block record of the authenticated account's repo.
+type BlockRecord struct {
+	Subject   string
+	Uri       string
+	RecordKey string
+}
+
+func (atpClient *ATPClient) ListBlockRecordsIter(ctx context.Context, opts *PageOptions) iter.Seq2[*BlockRecord, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*BlockRecord, *string, error) {
+			var resp *atproto.RepoListRecords_Output
+			err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+				resp, err = atproto.RepoListRecords(
+					ctx, atpClient.Client, atpClient.Config.GraphBlockLexicon, cursor, limit,
+					atpClient.Client.Auth.Did, false, "", "")
+				return err
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("error listing block records: %w", err)
+			}
+
+			records := make([]*BlockRecord, 0, len(resp.Records))
+			for _, record := range resp.Records {
+				block, ok := record.Value.Val.(*bsky.GraphBlock)
+				if !ok {
+					continue
+				}
+
+				records = append(records, &BlockRecord{
+					Subject:   block.Subject,
+					Uri:       record.Uri,
+					RecordKey: util.GetRecordKeyFromUrlOrAtUri(record.Uri),
+				})
+			}
+
+			return records, resp.Cursor, nil
+		})
+}
+
+// BulkBlockReport lists what BlockMany or UnblockMany changed. Unchanged counts the
+// accounts that were already blocked, or not blocked, respectively.
+type BulkBlockReport struct {
+	Blocked    []string
+	Unblocked  []string
+	Unchanged  int
+	Unresolved map[string]error
+	Failed     map[string]error
+}
+
+func newBulkBlockReport() *BulkBlockReport {
+	return &BulkBlockReport{
+		Unresolved: make(map[string]error),
+		Failed:     make(map[string]error),
+	}
+}
+
+// err joins all failures of the report.
+func (report *BulkBlockReport) err() error {
+	var errs []error
+	for didOrHandle, err := range report.Unresolved {
+		errs = append(errs, fmt.Errorf("%s: %w", didOrHandle, err))
+	}
+	for did, err := range report.Failed {
+		errs = append(errs, fmt.Errorf("%s: %w", did, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (atpClient *ATPClient) BlockMany(didsOrHandles []string) (*BulkBlockReport, error) {
+	return atpClient.BlockManyContext(context.Background(), didsOrHandles)
+}
+
+// BlockManyContext blocks every account of didsOrHandles that is not blocked yet,
+// in applyWrites batches. A failing batch is recorded in the report for each of its
+// accounts and does not stop the others. The returned error joins all failures.
+func (atpClient *ATPClient) BlockManyContext(ctx context.Context, didsOrHandles []string) (*BulkBlockReport, error) {
+	report := newBulkBlockReport()
+	dids := atpClient.resolveDids(ctx, didsOrHandles, report.Unresolved)
+
+	blocked := make(map[string]bool)
+	for record, err := range atpClient.ListBlockRecordsIter(ctx, nil) {
+		if err != nil {
+			return nil, err
+		}
+
+		blocked[record.Subject] = true
+	}
+
+	var block []string
+	seen := make(map[string]bool, len(dids))
+	for _, did := range dids {
+		// a repeated account would get a second block record in the same batch
+		if blocked[did] || seen[did] {
+			report.Unchanged++
+			continue
+		}
+
+		seen[did] = true
+		block = append(block, did)
+	}
+
+	createdAt := time.Now().Local().Format(time.RFC3339)
+	for start := 0; start < len(block); start += maxWritesPerApplyWrites {
+		batch := block[start:min(start+maxWritesPerApplyWrites, len(block))]
+
+		writes := make([]*atproto.RepoApplyWrites_Input_Writes_Elem, 0, len(batch))
+		for _, did := range batch {
+			writes = append(writes, &atproto.RepoApplyWrites_Input_Writes_Elem{
+				RepoApplyWrites_Create: &atproto.RepoApplyWrites_Create{
+					Collection: atpClient.Config.GraphBlockLexicon,
+					Value: &lexutil.LexiconTypeDecoder{
+						Val: &bsky.GraphBlock{
+							LexiconTypeID: atpClient.Config.GraphBlockLexicon,
+							CreatedAt:     createdAt,
+							Subject:       did,
+						},
+					},
+				},
+			})
+		}
+
+		if err := atpClient.applyWrites(ctx, writes); err != nil {
+			for _, did := range batch {
+				report.Failed[did] = fmt.Errorf("error blocking DID %s: %w", did, err)
+			}
+			continue
+		}
+
+		report.Blocked = append(report.Blocked, batch...)
+	}
+
+	return report, report.err()
+}
+
+func (atpClient *ATPClient) UnblockMany(didsOrHandles []string) (*BulkBlockReport, error) {
+	return atpClient.UnblockManyContext(context.Background(), didsOrHandles)
+}
+
+// UnblockManyContext deletes every block record of the accounts of didsOrHandles,
+// in applyWrites batches, without looking up their profiles. Failures are handled
+// as in BlockManyContext.
+func (atpClient *ATPClient) UnblockManyContext(ctx context.Context, didsOrHandles []string) (*BulkBlockReport, error) {
+	report := newBulkBlockReport()
+
+	want := make(map[string]bool)
+	for _, did := range atpClient.resolveDids(ctx, didsOrHandles, report.Unresolved) {
+		want[did] = true
+	}
+
+	var unblock []*BlockRecord
+	found := make(map[string]bool)
+	for record, err := range atpClient.ListBlockRecordsIter(ctx, nil) {
+		if err != nil {
+			return nil, err
+		}
+
+		if want[record.Subject] {
+			unblock = append(unblock, record)
+			found[record.Subject] = true
+		}
+	}
+	report.Unchanged = len(want) - len(found)
+
+	for start := 0; start < len(unblock); start += maxWritesPerApplyWrites {
+		batch := unblock[start:min(start+maxWritesPerApplyWrites, len(unblock))]
+
+		writes := make([]*atproto.RepoApplyWrites_Input_Writes_Elem, 0, len(batch))
+		for _, record := range batch {
+			writes = append(writes, &atproto.RepoApplyWrites_Input_Writes_Elem{
+				RepoApplyWrites_Delete: &atproto.RepoApplyWrites_Delete{
+					Collection: atpClient.Config.GraphBlockLexicon,
+					Rkey:       record.RecordKey,
+				},
+			})
+		}
+
+		err := atpClient.applyWrites(ctx, writes)
+		for _, record := range batch {
+			if err != nil {
+				report.Failed[record.Subject] = fmt.Errorf("error unblocking DID %s: %w", record.Subject, err)
+				continue
+			}
+
+			// a DID blocked by more than one record is only reported once
+			if !found[record.Subject] {
+				continue
+			}
+			found[record.Subject] = false
+			report.Unblocked = append(report.Unblocked, record.Subject)
+		}
+	}
+
+	return report, report.err()
+}
+
+// resolveDids turns didsOrHandles into DIDs, keeping their order and recording the
+// ones that do not resolve in unresolved. An account given twice, e.g. by handle
+// and by DID, is returned twice.
+func (atpClient *ATPClient) resolveDids(ctx context.Context, didsOrHandles []string, unresolved map[string]error) []string {
+	dids := make([]string, 0, len(didsOrHandles))
+
+	for _, didOrHandle := range didsOrHandles {
+		did, err := atpClient.resolveDid(ctx, didOrHandle)
+		if err != nil {
+			unresolved[didOrHandle] = err
+			continue
+		}
+
+		dids = append(dids, did)
+	}
+
+	return dids
+}
+
+// resolveDid resolves a handle, or validates a DID.
+func (atpClient *ATPClient) resolveDid(ctx context.Context, didOrHandle string) (string, error) {
+	if !identity.IsDid(didOrHandle) {
+		return atpClient.ResolveHandleContext(ctx, didOrHandle)
+	}
+
+	if err := identity.ValidateDid(didOrHandle); err != nil {
+		return "", err
+	}
+
+	return didOrHandle, nil
+}
+
+func (atpClient *ATPClient) applyWrites(ctx context.Context, writes []*atproto.RepoApplyWrites_Input_Writes_Elem) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.RepoApplyWrites(ctx, atpClient.Client, &atproto.RepoApplyWrites_Input{
+			Repo:   atpClient.Client.Auth.Did,
+			Writes: writes,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error applying %d writes: %w", len(writes), err)
+	}
+
+	return nil
+}
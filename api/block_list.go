@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type BlockListFormat string
+
+const (
+	BlockListCSV  BlockListFormat = "csv"
+	BlockListJSON BlockListFormat = "json"
+)
+
+var ErrUnknownBlockListFormat = errors.New("unknown block list format")
+
+// BlockListEntry is an account of a shared block list. Handle is informative only;
+// importing prefers Did and falls back to resolving Handle.
+type BlockListEntry struct {
+	Did    string `json:"did,omitempty"`
+	Handle string `json:"handle,omitempty"`
+}
+
+// WriteBlockList writes entries as a JSON array, or as CSV with a did,handle header.
+func WriteBlockList(w io.Writer, format BlockListFormat, entries []BlockListEntry) error {
+	switch format {
+	case BlockListCSV:
+		csvWriter := csv.NewWriter(w)
+		if err := csvWriter.Write([]string{"did", "handle"}); err != nil {
+			return fmt.Errorf("error writing block list: %w", err)
+		}
+		for _, entry := range entries {
+			if err := csvWriter.Write([]string{entry.Did, entry.Handle}); err != nil {
+				return fmt.Errorf("error writing block list: %w", err)
+			}
+		}
+
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return fmt.Errorf("error writing block list: %w", err)
+		}
+	case BlockListJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if entries == nil {
+			entries = []BlockListEntry{}
+		}
+		if err := encoder.Encode(entries); err != nil {
+			return fmt.Errorf("error writing block list: %w", err)
+		}
+	default:
+		return fmt.Errorf("error writing block list: %w: %q", ErrUnknownBlockListFormat, format)
+	}
+
+	return nil
+}
+
+// ReadBlockList reads a block list written by WriteBlockList. CSV lists may also be
+// a bare column of DIDs or handles, with or without a header.
+func ReadBlockList(r io.Reader, format BlockListFormat) ([]BlockListEntry, error) {
+	var entries []BlockListEntry
+
+	switch format {
+	case BlockListCSV:
+		csvReader := csv.NewReader(r)
+		csvReader.FieldsPerRecord = -1
+		csvReader.TrimLeadingSpace = true
+
+		rows, err := csvReader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("error reading block list: %w", err)
+		}
+
+		for i, row := range rows {
+			if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+				continue
+			}
+			if i == 0 && strings.EqualFold(strings.TrimSpace(row[0]), "did") {
+				continue
+			}
+
+			entry := BlockListEntry{}
+			value := strings.TrimSpace(row[0])
+			if strings.HasPrefix(value, "did:") {
+				entry.Did = value
+			} else {
+				entry.Handle = value
+			}
+			if len(row) > 1 && entry.Handle == "" {
+				entry.Handle = strings.TrimSpace(row[1])
+			}
+
+			entries = append(entries, entry)
+		}
+	case BlockListJSON:
+		if err := json.NewDecoder(r).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("error reading block list: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("error reading block list: %w: %q", ErrUnknownBlockListFormat, format)
+	}
+
+	return entries, nil
+}
+
+func (atpClient *ATPClient) ExportBlocks(w io.Writer, format BlockListFormat) error {
+	return atpClient.ExportBlocksContext(context.Background(), w, format)
+}
+
+// ExportBlocksContext writes every blocked account to w. Handles come from the block
+// profiles, so deleted and taken down accounts are exported with their DID only.
+func (atpClient *ATPClient) ExportBlocksContext(ctx context.Context, w io.Writer, format BlockListFormat) error {
+	handles := make(map[string]string)
+	for profile, err := range atpClient.GetBlocksIter(ctx, nil) {
+		if err != nil {
+			return err
+		}
+
+		handles[profile.Did] = profile.Handle
+	}
+
+	var entries []BlockListEntry
+	seen := make(map[string]bool)
+	for record, err := range atpClient.ListBlockRecordsIter(ctx, nil) {
+		if err != nil {
+			return err
+		}
+
+		if seen[record.Subject] {
+			continue
+		}
+		seen[record.Subject] = true
+
+		entries = append(entries, BlockListEntry{Did: record.Subject, Handle: handles[record.Subject]})
+	}
+
+	return WriteBlockList(w, format, entries)
+}
+
+func (atpClient *ATPClient) ImportBlocks(r io.Reader, format BlockListFormat) (*BulkBlockReport, error) {
+	return atpClient.ImportBlocksContext(context.Background(), r, format)
+}
+
+// ImportBlocksContext blocks every account of the block list read from r with
+// BlockManyContext.
+func (atpClient *ATPClient) ImportBlocksContext(
+	ctx context.Context, r io.Reader, format BlockListFormat) (*BulkBlockReport, error) {
+	entries, err := ReadBlockList(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	didsOrHandles := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		switch {
+		case entry.Did != "":
+			didsOrHandles = append(didsOrHandles, entry.Did)
+		case entry.Handle != "":
+			didsOrHandles = append(didsOrHandles, entry.Handle)
+		}
+	}
+
+	return atpClient.BlockManyContext(ctx, didsOrHandles)
+}
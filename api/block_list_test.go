@@ -0,0 +1,181 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadBlockList(t *testing.T) {
+	tests := []struct {
+		name   string
+		format BlockListFormat
+		input  string
+		want   []BlockListEntry
+	}{
+		{
+			name:   "csv with header",
+			format: BlockListCSV,
+			input:  "did,handle\ndid:plc:blocka,a.example.com\ndid:plc:blockb,\n",
+			want:   []BlockListEntry{{Did: "did:plc:blocka", Handle: "a.example.com"}, {Did: "did:plc:blockb"}},
+		},
+		{
+			name:   "csv header in other case",
+			format: BlockListCSV,
+			input:  "DID, Handle\ndid:plc:blocka, a.example.com\n",
+			want:   []BlockListEntry{{Did: "did:plc:blocka", Handle: "a.example.com"}},
+		},
+		{
+			name:   "csv column without header",
+			format: BlockListCSV,
+			input:  "did:plc:blocka\nb.example.com\n",
+			want:   []BlockListEntry{{Did: "did:plc:blocka"}, {Handle: "b.example.com"}},
+		},
+		{
+			name:   "csv handle first",
+			format: BlockListCSV,
+			input:  "a.example.com,ignored\n",
+			want:   []BlockListEntry{{Handle: "a.example.com"}},
+		},
+		{
+			name:   "csv blank lines",
+			format: BlockListCSV,
+			input:  "did,handle\n\ndid:plc:blocka,a.example.com\n\n  ,b.example.com\n\ndid:plc:blockc,\n",
+			want:   []BlockListEntry{{Did: "did:plc:blocka", Handle: "a.example.com"}, {Did: "did:plc:blockc"}},
+		},
+		{
+			name:   "csv header only after a blank line",
+			format: BlockListCSV,
+			input:  "\ndid,handle\ndid:plc:blocka,\n",
+			want:   []BlockListEntry{{Did: "did:plc:blocka"}},
+		},
+		{
+			// duplicates are left to BlockMany, which blocks each account once
+			name:   "csv duplicate accounts",
+			format: BlockListCSV,
+			input:  "did:plc:blocka\ndid:plc:blocka,a.example.com\n",
+			want:   []BlockListEntry{{Did: "did:plc:blocka"}, {Did: "did:plc:blocka", Handle: "a.example.com"}},
+		},
+		{
+			name:   "csv empty",
+			format: BlockListCSV,
+			input:  "",
+		},
+		{
+			name:   "json",
+			format: BlockListJSON,
+			input:  `[{"did":"did:plc:blocka","handle":"a.example.com"},{"handle":"b.example.com"}]`,
+			want:   []BlockListEntry{{Did: "did:plc:blocka", Handle: "a.example.com"}, {Handle: "b.example.com"}},
+		},
+		{
+			name:   "json duplicate accounts",
+			format: BlockListJSON,
+			input:  `[{"did":"did:plc:blocka"},{"did":"did:plc:blocka"}]`,
+			want:   []BlockListEntry{{Did: "did:plc:blocka"}, {Did: "did:plc:blocka"}},
+		},
+		{
+			name:   "json empty",
+			format: BlockListJSON,
+			input:  "[]",
+			want:   []BlockListEntry{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := ReadBlockList(strings.NewReader(test.input), test.format)
+			if err != nil {
+				t.Fatalf("reading block list: %v", err)
+			}
+			if !reflect.DeepEqual(entries, test.want) {
+				t.Errorf("entries = %+v, want %+v", entries, test.want)
+			}
+		})
+	}
+}
+
+func TestReadBlockListErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  BlockListFormat
+		input   string
+		wantErr error
+	}{
+		{name: "unknown format", format: "xml", input: "<blocks/>", wantErr: ErrUnknownBlockListFormat},
+		{name: "broken csv", format: BlockListCSV, input: "\"did:plc:blocka\n"},
+		{name: "broken json", format: BlockListJSON, input: `[{"did":`},
+		{name: "json object", format: BlockListJSON, input: `{"did":"did:plc:blocka"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadBlockList(strings.NewReader(test.input), test.format)
+			if err == nil {
+				t.Fatal("read a broken block list")
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("err = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteBlockList(t *testing.T) {
+	entries := []BlockListEntry{
+		{Did: "did:plc:blocka", Handle: "a.example.com"},
+		{Did: "did:plc:blockb"},
+		{Did: "did:plc:blocka", Handle: "a.example.com"},
+	}
+
+	tests := []struct {
+		name    string
+		format  BlockListFormat
+		entries []BlockListEntry
+		want    string
+	}{
+		{
+			name:    "csv",
+			format:  BlockListCSV,
+			entries: entries,
+			want:    "did,handle\ndid:plc:blocka,a.example.com\ndid:plc:blockb,\ndid:plc:blocka,a.example.com\n",
+		},
+		{name: "csv empty", format: BlockListCSV, want: "did,handle\n"},
+		{
+			name:    "json",
+			format:  BlockListJSON,
+			entries: entries[:2],
+			want: "[\n" +
+				"  {\n    \"did\": \"did:plc:blocka\",\n    \"handle\": \"a.example.com\"\n  },\n" +
+				"  {\n    \"did\": \"did:plc:blockb\"\n  }\n" +
+				"]\n",
+		},
+		{name: "json empty", format: BlockListJSON, want: "[]\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteBlockList(&buf, test.format, test.entries); err != nil {
+				t.Fatalf("writing block list: %v", err)
+			}
+			if buf.String() != test.want {
+				t.Errorf("block list = %q, want %q", buf.String(), test.want)
+			}
+
+			// what is written reads back unchanged, duplicates included
+			entries, err := ReadBlockList(&buf, test.format)
+			if err != nil {
+				t.Fatalf("reading block list back: %v", err)
+			}
+			if len(entries) != len(test.entries) || len(entries) > 0 && !reflect.DeepEqual(entries, test.entries) {
+				t.Errorf("read back %+v, want %+v", entries, test.entries)
+			}
+		})
+	}
+
+	if err := WriteBlockList(&bytes.Buffer{}, "xml", entries); !errors.Is(err, ErrUnknownBlockListFormat) {
+		t.Errorf("err = %v, want %v", err, ErrUnknownBlockListFormat)
+	}
+}
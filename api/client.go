@@ -5,32 +5,21 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/suvpen/suvatp/atperr"
+	"github.com/suvpen/suvatp/identity"
+	"github.com/suvpen/suvatp/oauth"
 	"net/http"
-	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
-type DidDoc struct {
-	Context            []string `json:"@context"`
-	Id                 string   `json:"id"`
-	AlsoKnownAs        []string `json:"alsoKnownAs"`
-	VerificationMethod []struct {
-		Id                 string `json:"id"`
-		Type               string `json:"type"`
-		Controller         string `json:"controller"`
-		PublicKeyMultibase string `json:"publicKeyMultibase"`
-	} `json:"verificationMethod"`
-	Service []struct {
-		Id              string `json:"id"`
-		Type            string `json:"type"`
-		ServiceEndpoint string `json:"serviceEndpoint"`
-	} `json:"service"`
-}
+type DidDoc = identity.DidDoc
 
 type Config struct {
 	ATProtoEndpoint    string `json:"at_proto_endpoint"`
@@ -42,6 +31,14 @@ type Config struct {
 	GraphBlockLexicon  string `json:"graph_block_lexicon"`
 	LabelerService     string `json:"labeler_service"`
 	Retries            int    `json:"retries"`
+
+	RetryPolicy     *RetryPolicy `json:"retry_policy,omitempty"`
+	PLCDirectoryURL string       `json:"plc_directory_url,omitempty"`
+
+	ChatProxyDid     string `json:"chat_proxy_did,omitempty"`
+	ChatServiceId    string `json:"chat_service_id,omitempty"`
+	LabelerProxyDid  string `json:"labeler_proxy_did,omitempty"`
+	LabelerServiceId string `json:"labeler_service_id,omitempty"`
 }
 
 type ATPClient struct {
@@ -51,7 +48,179 @@ type ATPClient struct {
 	LabelerClient *xrpc.Client
 	Did           string
 	AppPassword   string
-	RetryCount    int
+
+	// mu guards the session tokens: calls hold it for reading while in flight and
+	// renewals take it for writing, so an ATPClient can be shared between goroutines.
+	mu               sync.RWMutex
+	store            SessionStore
+	omitAppPassword  bool
+	authFactorPrompt AuthFactorPrompt
+	resolver         *identity.Resolver
+	httpClient       *http.Client
+	userAgent        string
+	limiter          *RateLimiter
+	rateLimits       *rateLimitState
+	oauth            *oauthState
+	serviceTransport http.RoundTripper
+}
+
+// storedSession is the persisted form of an ATPClient.
+type storedSession struct {
+	Config        *Config `json:"config"`
+	Client        *xrpc.Client
+	PdsClient     *xrpc.Client
+	LabelerClient *xrpc.Client
+	Did           string
+	AppPassword   string
+	OAuth         *oauth.Session `json:"oauth,omitempty"`
+}
+
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	store            SessionStore
+	omitAppPassword  bool
+	authFactorToken  string
+	authFactorPrompt AuthFactorPrompt
+	resolver         *identity.Resolver
+	httpClient       *http.Client
+	middleware       []Middleware
+	userAgent        string
+	limiter          *RateLimiter
+	rateLimits       *rateLimitState
+	oauth            *oauthState
+	failFast         bool
+	// serviceTransport is the transport below the client's own layers, used for
+	// third-party services so their responses stay out of the PDS budgets
+	serviceTransport http.RoundTripper
+}
+
+// Middleware wraps the transport used for every request of a client, e.g. to add
+// tracing or logging.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// WithHTTPClient sets the http.Client shared by Client, PdsClient and LabelerClient,
+// so timeouts, proxies and TLS settings can be configured. It is copied, not modified.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(opts *clientOptions) {
+		opts.httpClient = httpClient
+	}
+}
+
+// WithMiddleware wraps the transport of the HTTP client; the first middleware
+// given sees each request first.
+func WithMiddleware(middleware ...Middleware) ClientOption {
+	return func(opts *clientOptions) {
+		opts.middleware = append(opts.middleware, middleware...)
+	}
+}
+
+func WithUserAgent(userAgent string) ClientOption {
+	return func(opts *clientOptions) {
+		opts.userAgent = userAgent
+	}
+}
+
+func (options *clientOptions) buildHTTPClient() *http.Client {
+	httpClient := &http.Client{}
+	if options.httpClient != nil {
+		clientCopy := *options.httpClient
+		httpClient = &clientCopy
+	}
+
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	for i := len(options.middleware) - 1; i >= 0; i-- {
+		transport = options.middleware[i](transport)
+	}
+
+	options.serviceTransport = transport
+	options.rateLimits = newRateLimitState()
+	options.oauth = &oauthState{}
+
+	httpClient.Transport = &retryHintTransport{base: &rateLimitTransport{
+		base:     &proxyTransport{base: &dpopTransport{base: transport, state: options.oauth}},
+		limiter:  options.limiter,
+		state:    options.rateLimits,
+		failFast: options.failFast,
+	}}
+
+	return httpClient
+}
+
+func (options *clientOptions) apply(atpClient *ATPClient) {
+	atpClient.store = options.store
+	atpClient.omitAppPassword = options.omitAppPassword
+	atpClient.authFactorPrompt = options.authFactorPrompt
+	atpClient.resolver = options.resolver
+	atpClient.httpClient = options.httpClient
+	atpClient.userAgent = options.userAgent
+	atpClient.limiter = options.limiter
+	atpClient.rateLimits = options.rateLimits
+	atpClient.oauth = options.oauth
+	atpClient.serviceTransport = options.serviceTransport
+}
+
+// WithRateLimiter replaces the client's write limiter, e.g. to share one between
+// clients of the same account or to use other WriteLimits. nil disables it.
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(opts *clientOptions) {
+		opts.limiter = limiter
+	}
+}
+
+// WithRateLimitFailFast makes requests fail with ErrRateLimitExhausted when a budget
+// is used up, instead of waiting for it to recover.
+func WithRateLimitFailFast() ClientOption {
+	return func(opts *clientOptions) {
+		opts.failFast = true
+	}
+}
+
+// AuthFactorPrompt is asked for the sign in code when the server demands one, e.g.
+// for accounts with email two-factor authentication enabled.
+type AuthFactorPrompt func(ctx context.Context, required *atperr.AuthFactorTokenRequiredError) (string, error)
+
+// WithAuthFactorToken sends token with the first sign in attempt.
+func WithAuthFactorToken(token string) ClientOption {
+	return func(opts *clientOptions) {
+		opts.authFactorToken = token
+	}
+}
+
+// WithAuthFactorPrompt calls prompt whenever a sign in is answered with
+// AuthFactorTokenRequired. Without it such sign ins fail with
+// *atperr.AuthFactorTokenRequiredError.
+func WithAuthFactorPrompt(prompt AuthFactorPrompt) ClientOption {
+	return func(opts *clientOptions) {
+		opts.authFactorPrompt = prompt
+	}
+}
+
+// WithoutPersistedAppPassword keeps the app password out of the session store. Stored
+// sessions are then resumed with the refresh JWT alone.
+func WithoutPersistedAppPassword() ClientOption {
+	return func(opts *clientOptions) {
+		opts.omitAppPassword = true
+	}
+}
+
+// WithResolver shares an identity resolver, and its cache, between clients. By
+// default every client gets its own resolver using Config.PLCDirectoryURL.
+func WithResolver(resolver *identity.Resolver) ClientOption {
+	return func(opts *clientOptions) {
+		opts.resolver = resolver
+	}
+}
+
+// WithSessionStore replaces the default ATPDir file store used to persist the session.
+func WithSessionStore(store SessionStore) ClientOption {
+	return func(opts *clientOptions) {
+		opts.store = store
+	}
 }
 
 type Jwt struct {
@@ -62,45 +231,107 @@ type Jwt struct {
 	Aud   string `json:"aud"`
 }
 
-func writeAuthFile(clientAuthFilePath string, atpClient ATPClient) error {
-	atpClient.Client.Client = nil
-	atpClient.PdsClient.Client = nil
-	atpClient.LabelerClient.Client = nil
+// sleepContext pauses for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	clientAuthJson, err := json.Marshal(atpClient)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// HTTPClient returns the http.Client used for all requests of atpClient.
+func (atpClient *ATPClient) HTTPClient() *http.Client {
+	return atpClient.httpClient
+}
+
+// attach points xrpcClient at the client's HTTP client and user agent.
+func (atpClient *ATPClient) attach(xrpcClient *xrpc.Client) *xrpc.Client {
+	xrpcClient.Client = atpClient.httpClient
+	xrpcClient.UserAgent = nil
+
+	if atpClient.userAgent != "" {
+		userAgent := atpClient.userAgent
+		xrpcClient.UserAgent = &userAgent
+	}
+
+	return xrpcClient
+}
+
+func withoutHTTPClient(xrpcClient *xrpc.Client) *xrpc.Client {
+	if xrpcClient == nil {
+		return nil
+	}
+
+	stripped := *xrpcClient
+	stripped.Client = nil
+	stripped.UserAgent = nil
+
+	return &stripped
+}
+
+func (atpClient *ATPClient) saveSession() error {
+	stored := storedSession{
+		Config:        atpClient.Config,
+		Client:        withoutHTTPClient(atpClient.Client),
+		PdsClient:     withoutHTTPClient(atpClient.PdsClient),
+		LabelerClient: withoutHTTPClient(atpClient.LabelerClient),
+		Did:           atpClient.Did,
+		AppPassword:   atpClient.AppPassword,
+	}
+	stored.OAuth, _, _ = atpClient.oauth.get()
+	if atpClient.omitAppPassword {
+		stored.AppPassword = ""
+	}
+
+	sessionJson, err := json.Marshal(stored)
 	if err != nil {
-		return fmt.Errorf(
-			"error marshalling %s: %w", clientAuthFilePath, err)
+		return fmt.Errorf("error marshalling session of %s: %w", atpClient.Did, err)
 	}
 
-	if err = os.WriteFile(clientAuthFilePath, clientAuthJson, 0666); err != nil {
-		return fmt.Errorf("error writing %s: %w", clientAuthFilePath, err)
+	if err = atpClient.store.Save(atpClient.Config.ATProtoEndpoint, atpClient.Did, sessionJson); err != nil {
+		return fmt.Errorf("error saving session of %s: %w", atpClient.Did, err)
 	}
 
 	return nil
 }
 
-func refreshSession(atpClient *ATPClient, clientAuthFilePath string) (*ATPClient, error) {
-	atpClient.Client.Auth.AccessJwt = atpClient.Client.Auth.RefreshJwt
+// setAuth swaps in one shared AuthInfo so Client, PdsClient and LabelerClient never
+// disagree about the tokens in use.
+func (atpClient *ATPClient) setAuth(accessJwt, refreshJwt, handle, did string) {
+	auth := &xrpc.AuthInfo{
+		AccessJwt:  accessJwt,
+		RefreshJwt: refreshJwt,
+		Handle:     handle,
+		Did:        did,
+	}
+
+	atpClient.Client.Auth = auth
+	atpClient.PdsClient.Auth = auth
 
-	refresh, err := atproto.ServerRefreshSession(context.TODO(), atpClient.Client)
-	if err != nil {
-		return nil, err
+	if session, client, _ := atpClient.oauth.get(); session != nil {
+		atpClient.oauth.set(session, client, accessJwt)
 	}
 
-	atpClient.Client.Auth.Did = refresh.Did
-	atpClient.Client.Auth.AccessJwt = refresh.AccessJwt
-	atpClient.Client.Auth.RefreshJwt = refresh.RefreshJwt
+	atpClient.LabelerClient.Auth = auth
+}
 
-	atpClient.PdsClient.Auth.AccessJwt = refresh.AccessJwt
-	atpClient.PdsClient.Auth.RefreshJwt = refresh.RefreshJwt
+func refreshSession(ctx context.Context, atpClient *ATPClient) (*ATPClient, error) {
+	refreshClient := *atpClient.Client
+	refreshClient.Auth = &xrpc.AuthInfo{AccessJwt: atpClient.Client.Auth.RefreshJwt}
 
-	if atpClient.LabelerClient.Auth != nil {
-		atpClient.LabelerClient.Auth.AccessJwt = refresh.AccessJwt
-		atpClient.LabelerClient.Auth.RefreshJwt = refresh.RefreshJwt
+	refresh, err := atproto.ServerRefreshSession(ctx, &refreshClient)
+	if err != nil {
+		return nil, atperr.FromError(err, refreshSessionNSID)
 	}
 
-	err = writeAuthFile(clientAuthFilePath, *atpClient)
+	atpClient.setAuth(refresh.AccessJwt, refresh.RefreshJwt, refresh.Handle, refresh.Did)
+
+	err = atpClient.saveSession()
 	if err != nil {
 		return nil, err
 	}
@@ -108,11 +339,11 @@ func refreshSession(atpClient *ATPClient, clientAuthFilePath string) (*ATPClient
 	return atpClient, nil
 }
 
-func getJWTExpiration(atpClient *ATPClient, clientAuthFilePath string) (bool, error) {
+func getJWTExpiration(atpClient *ATPClient) (bool, error) {
 	parts := strings.Split(atpClient.Client.Auth.AccessJwt, ".")
 	payloadJson, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return false, fmt.Errorf("error decoding %s jwtJson: %w", clientAuthFilePath, err)
+		return false, fmt.Errorf("error decoding %s jwtJson: %w", atpClient.Did, err)
 	}
 
 	var jwtJson bytes.Buffer
@@ -123,160 +354,238 @@ func getJWTExpiration(atpClient *ATPClient, clientAuthFilePath string) (bool, er
 	var jwt *Jwt
 	err = json.Unmarshal([]byte(jwtJson.String()), &jwt)
 	if err != nil {
-		return false, fmt.Errorf("error unmarshalling JWT of %s: %w", clientAuthFilePath, err)
+		return false, fmt.Errorf("error unmarshalling JWT of %s: %w", atpClient.Did, err)
 	}
 
 	return time.Now().Add(time.Minute).Unix() >= jwt.Exp, nil
 }
 
-func createSession(did, appPassword, clientAuthFilePath string, config *Config) (*ATPClient, error) {
+func signIn(
+	ctx context.Context, xrpcClient *xrpc.Client, identifier, password, authFactorToken string,
+	prompt AuthFactorPrompt) (*atproto.ServerCreateSession_Output, error) {
+	sessionInput := &atproto.ServerCreateSession_Input{
+		Identifier: identifier,
+		Password:   password,
+	}
+
+	if authFactorToken != "" {
+		sessionInput.AuthFactorToken = &authFactorToken
+	}
+
+	session, err := atproto.ServerCreateSession(ctx, xrpcClient, sessionInput)
+	if err == nil || !atperr.IsAuthFactorTokenRequiredError(err) {
+		return session, atperr.FromError(err, createSessionNSID)
+	}
+
+	required := atperr.NewAuthFactorTokenRequiredError(identifier, atperr.FromError(err, createSessionNSID))
+	if prompt == nil {
+		return nil, required
+	}
+
+	token, err := prompt(ctx, required)
+	if err != nil {
+		return nil, fmt.Errorf("error obtaining auth factor token: %w", err)
+	}
+
+	sessionInput.AuthFactorToken = &token
+
+	session, err = atproto.ServerCreateSession(ctx, xrpcClient, sessionInput)
+
+	return session, atperr.FromError(err, createSessionNSID)
+}
+
+func createSession(
+	ctx context.Context, did, appPassword string, config *Config, options *clientOptions) (*ATPClient, error) {
 	atpClient := &ATPClient{
-		Config: config,
-		Client: &xrpc.Client{
-			Client: new(http.Client),
-			Host:   config.ATProtoEndpoint,
-		},
+		Config:      config,
 		Did:         did,
 		AppPassword: appPassword,
 	}
+	options.apply(atpClient)
 
-	sessionInput := &atproto.ServerCreateSession_Input{
-		Identifier: did,
-		Password:   appPassword,
-	}
+	atpClient.Client = atpClient.attach(&xrpc.Client{Host: config.ATProtoEndpoint})
 
-	session, err := atproto.ServerCreateSession(context.TODO(), atpClient.Client, sessionInput)
+	session, err := signIn(
+		ctx, atpClient.Client, did, appPassword, options.authFactorToken, options.authFactorPrompt)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect: %w", err)
 	}
 
-	resultJson, err := json.Marshal(*session.DidDoc)
+	err = atpClient.startSession(
+		ctx, session.AccessJwt, session.RefreshJwt, session.Handle, session.Did, session.DidDoc)
 	if err != nil {
 		return nil, err
 	}
 
+	return atpClient, nil
+}
+
+// startSession sets up the clients of a freshly authenticated atpClient, locating
+// the PDS through the DID document the server returned or by resolving the DID, and
+// saves the session.
+func (atpClient *ATPClient) startSession(
+	ctx context.Context, accessJwt, refreshJwt, handle, did string, sessionDidDoc *interface{}) error {
 	var didDoc *DidDoc
-	err = json.Unmarshal(resultJson, &didDoc)
-	if err != nil {
-		return nil, err
+	if sessionDidDoc != nil {
+		resultJson, err := json.Marshal(*sessionDidDoc)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(resultJson, &didDoc)
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		didDoc, err = atpClient.resolver.ResolveDid(ctx, did)
+		if err != nil {
+			return err
+		}
+	}
+
+	pdsEndpoint := didDoc.PDSEndpoint()
+	if pdsEndpoint == "" {
+		return fmt.Errorf("error creating session of %s: DID document has no %s service",
+			atpClient.Did, identity.AtprotoPdsServiceId)
 	}
 
 	//ATPROTO CLIENT
 	atpClient.Client.Auth = &xrpc.AuthInfo{
-		AccessJwt:  session.AccessJwt,
-		RefreshJwt: session.RefreshJwt,
-		Handle:     session.Handle,
-		Did:        session.Did,
+		AccessJwt:  accessJwt,
+		RefreshJwt: refreshJwt,
+		Handle:     handle,
+		Did:        did,
 	}
 
 	//PDS CLIENT
-	atpClient.PdsClient = &xrpc.Client{
-		Client: new(http.Client),
-		Host:   didDoc.Service[0].ServiceEndpoint,
-	}
-	atpClient.PdsClient.Auth = atpClient.Client.Auth
-
-	seeds := make(map[string]string)
-	seeds["Atproto-Proxy"] = "did:web:api.bsky.chat#bsky_chat"
-	atpClient.PdsClient.Headers = seeds
+	atpClient.PdsClient = atpClient.newProxiedClient(pdsEndpoint, atpClient.Config.chatProxy())
 
 	//LABELER CLIENT
-	atpClient.LabelerClient = &xrpc.Client{Client: new(http.Client)}
-	if len(didDoc.Service) > 1 {
-		atpClient.LabelerClient.Host = didDoc.Service[0].ServiceEndpoint
-		atpClient.LabelerClient.Auth = atpClient.Client.Auth
+	atpClient.LabelerClient = atpClient.newProxiedClient(pdsEndpoint, atpClient.Config.labelerProxy())
 
-		seeds = make(map[string]string)
-		seeds["Atproto-Proxy"] = "did:plc:yojwcfgpkxq35sv5wioglqad#atproto_labeler"
-		atpClient.LabelerClient.Headers = seeds
-	}
+	return atpClient.saveSession()
+}
 
-	err = writeAuthFile(clientAuthFilePath, *atpClient)
-	if err != nil {
-		return nil, err
+// DefaultConfig returns the configuration used when Client is given a nil Config.
+func DefaultConfig() *Config {
+	return &Config{
+		ATProtoEndpoint:    DefaultATProtoEndpoint,
+		ProfilesCollection: DefaultProfilesCollection,
+		PostsCollection:    DefaultPostsCollection,
+		RepostsCollection:  DefaultRepostsCollection,
+		LikesCollection:    DefaultLikeCollection,
+		GraphFollowLexicon: DefaultGraphFollowLexicon,
+		GraphBlockLexicon:  DefaultGraphBlockLexicon,
+		LabelerService:     DefaultLabelerService,
+		Retries:            DefaultRetries,
 	}
-
-	atpClient.Client.Client = new(http.Client)
-	atpClient.PdsClient.Client = new(http.Client)
-	atpClient.LabelerClient.Client = new(http.Client)
-
-	return atpClient, nil
 }
 
-func getClientAuthFile(atpEndpoint, did string) (string, error) {
-	atpName := strings.Replace(atpEndpoint, "https://", "", 1)
-	didFileName := strings.Replace(did, "did:plc:", "", 1)
-	clientAuthFilePath := fmt.Sprintf(ATPClientAuthJsonFile, atpName, didFileName)
+func newClientOptions(config *Config, opts []ClientOption) *clientOptions {
+	options := &clientOptions{store: DefaultSessionStore(), limiter: NewRateLimiter(DefaultWriteLimits())}
+	for _, opt := range opts {
+		opt(options)
+	}
 
-	_ = os.Mkdir(ATPDir, os.ModePerm)
+	var baseTransport http.RoundTripper
+	if options.httpClient != nil {
+		baseTransport = options.httpClient.Transport
+	}
 
-	if _, err := os.Stat(clientAuthFilePath); err != nil {
-		_, err = os.Create(clientAuthFilePath)
-		if err != nil {
-			return "", fmt.Errorf("error creating %s: %w", clientAuthFilePath, err)
-		}
+	options.httpClient = options.buildHTTPClient()
+
+	if options.resolver == nil {
+		// resolution keeps the resolver's own timeout and bypasses the rate limit,
+		// DPoP and proxy transports of the client
+		options.resolver = identity.NewResolver(config.PLCDirectoryURL)
+		options.resolver.HTTPClient.Transport = baseTransport
 	}
 
-	return clientAuthFilePath, nil
+	return options
 }
 
-func Client(did, appPassword string, config *Config) (*ATPClient, error) {
+func Client(did, appPassword string, config *Config, opts ...ClientOption) (*ATPClient, error) {
+	return ClientContext(context.Background(), did, appPassword, config, opts...)
+}
+
+func ClientContext(
+	ctx context.Context, did, appPassword string, config *Config, opts ...ClientOption) (*ATPClient, error) {
 	var atpClient *ATPClient
 
 	if config == nil {
-		config = &Config{
-			ATProtoEndpoint:    DefaultATProtoEndpoint,
-			ProfilesCollection: DefaultProfilesCollection,
-			PostsCollection:    DefaultPostsCollection,
-			RepostsCollection:  DefaultRepostsCollection,
-			LikesCollection:    DefaultLikeCollection,
-			GraphFollowLexicon: DefaultGraphFollowLexicon,
-			GraphBlockLexicon:  DefaultGraphBlockLexicon,
-			LabelerService:     DefaultLabelerService,
-			Retries:            DefaultRetries,
-		}
+		config = DefaultConfig()
 	}
 
-	clientAuthFilePath, err := getClientAuthFile(config.ATProtoEndpoint, did)
-	if err != nil {
-		return nil, err
-	}
+	options := newClientOptions(config, opts)
 
-	fileContent, err := os.ReadFile(clientAuthFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("error reading %s: %w", clientAuthFilePath, err)
+	sessionJson, err := options.store.Load(config.ATProtoEndpoint, did)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return nil, fmt.Errorf("error loading session of %s: %w", did, err)
 	}
 
-	if string(fileContent) == "" {
-		return createSession(did, appPassword, clientAuthFilePath, config)
+	if errors.Is(err, ErrSessionNotFound) {
+		return createSession(ctx, did, appPassword, config, options)
 	} else {
-		if err = json.Unmarshal(fileContent, &atpClient); err != nil {
-			return nil, fmt.Errorf("error unmarshalling %s: %w", clientAuthFilePath, err)
+		if err = json.Unmarshal(sessionJson, &atpClient); err != nil {
+			return nil, fmt.Errorf("error unmarshalling session of %s: %w", did, err)
+		}
+
+		options.apply(atpClient)
+		atpClient.attach(atpClient.Client)
+
+		var stored storedSession
+		if err = json.Unmarshal(sessionJson, &stored); err != nil {
+			return nil, fmt.Errorf("error unmarshalling session of %s: %w", did, err)
 		}
+		if stored.OAuth != nil {
+			atpClient.oauth.set(stored.OAuth, stored.OAuth.Client(options.httpClient), atpClient.Client.Auth.AccessJwt)
+		}
+
+		atpClient.attach(atpClient.PdsClient)
+		atpClient.attach(atpClient.LabelerClient)
 
-		if appPassword != atpClient.AppPassword || !reflect.DeepEqual(atpClient.Config, config) {
+		// sessions saved before the labeler client was always configured
+		if atpClient.LabelerClient.Host == "" {
+			atpClient.LabelerClient = atpClient.newProxiedClient(atpClient.PdsClient.Host, config.labelerProxy())
+		}
+
+		storedAppPassword := atpClient.AppPassword
+		passwordChanged := appPassword != storedAppPassword
+		if options.omitAppPassword {
+			// nothing to compare against once the password is no longer stored,
+			// and the caller may resume with an empty one
+			passwordChanged = appPassword != "" && storedAppPassword != "" && appPassword != storedAppPassword
+		}
+
+		if passwordChanged || !reflect.DeepEqual(atpClient.Config, config) {
 			atpClient.AppPassword = appPassword
 			atpClient.Config = config
 
-			return createSession(did, appPassword, clientAuthFilePath, config)
+			return createSession(ctx, did, appPassword, config, options)
 		}
 
-		jwtIsExpired, err := getJWTExpiration(atpClient, clientAuthFilePath)
+		if appPassword != "" {
+			atpClient.AppPassword = appPassword
+		}
+
+		if options.omitAppPassword && storedAppPassword != "" {
+			if err = atpClient.saveSession(); err != nil {
+				return nil, err
+			}
+		}
+
+		jwtIsExpired, err := atpClient.sessionExpired()
 		if err != nil {
 			return nil, err
 		}
 
 		if jwtIsExpired {
-			atpClient, err = refreshSession(atpClient, clientAuthFilePath)
-			if err != nil {
+			if err = atpClient.renewSession(ctx, atpClient.Client.Auth.AccessJwt); err != nil {
 				return nil, err
 			}
 		}
 
-		atpClient.Client.Client = new(http.Client)
-		atpClient.PdsClient.Client = new(http.Client)
-		atpClient.LabelerClient.Client = new(http.Client)
-
 		return atpClient, nil
 	}
 }
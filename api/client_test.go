@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/suvpen/suvatp/atperr"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignInAuthFactorTokenRequired(t *testing.T) {
+	const prompt = "A sign in code has been sent to your email address"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeXRPCError(w, http.StatusUnauthorized, "AuthFactorTokenRequired", prompt)
+	}))
+	defer server.Close()
+
+	_, err := signIn(context.Background(), &xrpc.Client{Host: server.URL}, testDid, testAppPassword, "", nil)
+
+	if !errors.Is(err, atperr.ErrAuthFactorTokenRequired) {
+		t.Errorf("errors.Is(%v, ErrAuthFactorTokenRequired) = false", err)
+	}
+
+	var required *atperr.AuthFactorTokenRequiredError
+	if !errors.As(err, &required) {
+		t.Fatalf("err = %T, want *atperr.AuthFactorTokenRequiredError", err)
+	}
+	if required.Identifier != testDid || required.Prompt != prompt {
+		t.Errorf("identifier = %s, prompt = %q", required.Identifier, required.Prompt)
+	}
+
+	atpErr, ok := atperr.AsATPError(err)
+	if !ok || atpErr.Endpoint != createSessionNSID {
+		t.Errorf("ATPError = %v, want one for %s", atpErr, createSessionNSID)
+	}
+}
@@ -1,8 +1,11 @@
 package api
 
 const (
-	ATPDir                = ".atp"
+	ATPDir = ".atp"
+	// Deprecated: sessions are stored by a SessionStore; FileSessionStore names its
+	// files with ATPClientAuthFileName inside its own directory.
 	ATPClientAuthJsonFile = ".atp/%s_%s_auth.json"
+	ATPClientAuthFileName = "%s_%s_auth.json"
 
 	DefaultATProtoEndpoint = "https://bsky.social"
 
@@ -13,9 +16,18 @@ const (
 	DefaultGraphFollowLexicon = "app.bsky.graph.follow"
 	DefaultGraphBlockLexicon  = "app.bsky.graph.block"
 	DefaultLabelerService     = "app.bsky.labeler.service"
+	GraphListLexicon          = "app.bsky.graph.list"
+	GraphListItemLexicon      = "app.bsky.graph.listitem"
+	GraphListBlockLexicon     = "app.bsky.graph.listblock"
+	GraphStarterPackLexicon   = "app.bsky.graph.starterpack"
 	DefaultRetries            = 1
 )
 
+const (
+	createSessionNSID  = "com.atproto.server.createSession"
+	refreshSessionNSID = "com.atproto.server.refreshSession"
+)
+
 const (
 	FilterPostsWithReplies      = "posts_with_replies"
 	FilterPostsNoReplies        = "posts_no_replies"
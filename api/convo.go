@@ -4,112 +4,90 @@ import (
 	"context"
 	"fmt"
 	"github.com/bluesky-social/indigo/api/chat"
-	"github.com/suvpen/suvatp/atperr"
-	"time"
 )
 
 func (atpClient *ATPClient) GetConvoForMembers(targetDid string) (*chat.ConvoGetConvoForMembers_Output, error) {
-	resp, err := chat.ConvoGetConvoForMembers(context.TODO(), atpClient.PdsClient, []string{targetDid})
+	return atpClient.GetConvoForMembersContext(context.Background(), targetDid)
+}
+
+func (atpClient *ATPClient) GetConvoForMembersContext(ctx context.Context, targetDid string) (*chat.ConvoGetConvoForMembers_Output, error) {
+	var resp *chat.ConvoGetConvoForMembers_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = chat.ConvoGetConvoForMembers(ctx, atpClient.PdsClient, []string{targetDid})
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetConvoForMembers(targetDid)
-			} else {
-				return nil, fmt.Errorf("error getting convo for members %s : %w", targetDid, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting convo for members %s : %w", targetDid, err)
-		}
+		return nil, fmt.Errorf("error getting convo for members %s : %w", targetDid, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) ListConvos(cursor string, limit int64) (*chat.ConvoListConvos_Output, error) {
-	resp, err := chat.ConvoListConvos(
-		context.TODO(), atpClient.PdsClient, cursor, limit)
+	return atpClient.ListConvosContext(context.Background(), cursor, limit)
+}
+
+func (atpClient *ATPClient) ListConvosContext(ctx context.Context, cursor string, limit int64) (*chat.ConvoListConvos_Output, error) {
+	var resp *chat.ConvoListConvos_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = chat.ConvoListConvos(
+			ctx, atpClient.PdsClient, cursor, limit)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.ListConvos(cursor, limit)
-			} else {
-				return nil, fmt.Errorf("error getting chat list: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting chat list: %w", err)
-		}
+		return nil, fmt.Errorf("error getting chat list: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) GetLog(cursor string) (*chat.ConvoGetLog_Output, error) {
-	resp, err := chat.ConvoGetLog(context.TODO(), atpClient.PdsClient, cursor)
+	return atpClient.GetLogContext(context.Background(), cursor)
+}
+
+func (atpClient *ATPClient) GetLogContext(ctx context.Context, cursor string) (*chat.ConvoGetLog_Output, error) {
+	var resp *chat.ConvoGetLog_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = chat.ConvoGetLog(ctx, atpClient.PdsClient, cursor)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetLog(cursor)
-			} else {
-				return nil, fmt.Errorf("error getting chat log: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting chat log: %w", err)
-		}
+		return nil, fmt.Errorf("error getting chat log: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) SendMessage(msgInput *chat.ConvoSendMessage_Input) (*chat.ConvoDefs_MessageView, error) {
-	resp, err := chat.ConvoSendMessage(context.TODO(), atpClient.PdsClient, msgInput)
+	return atpClient.SendMessageContext(context.Background(), msgInput)
+}
+
+func (atpClient *ATPClient) SendMessageContext(ctx context.Context, msgInput *chat.ConvoSendMessage_Input) (*chat.ConvoDefs_MessageView, error) {
+	var resp *chat.ConvoDefs_MessageView
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = chat.ConvoSendMessage(ctx, atpClient.PdsClient, msgInput)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.SendMessage(msgInput)
-			} else {
-				return nil, fmt.Errorf("error sending message: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error sending message: %w", err)
-		}
+		return nil, fmt.Errorf("error sending message: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) SendMessageBatch(msgBatchInput *chat.ConvoSendMessageBatch_Input) (*chat.ConvoSendMessageBatch_Output, error) {
-	resp, err := chat.ConvoSendMessageBatch(context.TODO(), atpClient.PdsClient, msgBatchInput)
+	return atpClient.SendMessageBatchContext(context.Background(), msgBatchInput)
+}
+
+func (atpClient *ATPClient) SendMessageBatchContext(ctx context.Context, msgBatchInput *chat.ConvoSendMessageBatch_Input) (*chat.ConvoSendMessageBatch_Output, error) {
+	var resp *chat.ConvoSendMessageBatch_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = chat.ConvoSendMessageBatch(ctx, atpClient.PdsClient, msgBatchInput)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.SendMessageBatch(msgBatchInput)
-			} else {
-				return nil, fmt.Errorf("error sending message batch: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error sending message batch: %w", err)
-		}
+		return nil, fmt.Errorf("error sending message batch: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
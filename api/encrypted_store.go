@@ -0,0 +1,167 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	sessionEnvelopeVersion = 1
+
+	kdfScrypt = "scrypt"
+	scryptN   = 1 << 15
+	scryptR   = 8
+	scryptP   = 1
+	saltSize  = 16
+)
+
+type sessionEnvelope struct {
+	Version    int    `json:"version"`
+	Kdf        string `json:"kdf,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// EncryptedSessionStore seals sessions with AES-GCM before handing them to Store.
+// Plaintext sessions found on Load are returned as-is and re-saved encrypted, so
+// existing .atp files are migrated the first time they are read. Anything else that
+// is not a valid envelope is an error, so damaged ciphertext is never re-sealed.
+type EncryptedSessionStore struct {
+	Store SessionStore
+
+	key        []byte
+	passphrase []byte
+}
+
+// NewEncryptedSessionStore uses key directly; it must be 16, 24 or 32 bytes long.
+func NewEncryptedSessionStore(store SessionStore, key []byte) (*EncryptedSessionStore, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("error creating encrypted session store: invalid key length %d", len(key))
+	}
+
+	return &EncryptedSessionStore{Store: store, key: append([]byte(nil), key...)}, nil
+}
+
+// NewPassphraseSessionStore derives a fresh key with scrypt and a random salt for every save.
+func NewPassphraseSessionStore(store SessionStore, passphrase string) (*EncryptedSessionStore, error) {
+	if passphrase == "" {
+		return nil, errors.New("error creating encrypted session store: empty passphrase")
+	}
+
+	return &EncryptedSessionStore{Store: store, passphrase: []byte(passphrase)}, nil
+}
+
+func (store *EncryptedSessionStore) aead(salt []byte) (cipher.AEAD, error) {
+	key := store.key
+	if key == nil {
+		derivedKey, err := scrypt.Key(store.passphrase, salt, scryptN, scryptR, scryptP, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		key = derivedKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (store *EncryptedSessionStore) Load(endpoint, did string) ([]byte, error) {
+	data, err := store.Store.Load(endpoint, did)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope sessionEnvelope
+	if err = json.Unmarshal(data, &envelope); err != nil || envelope.Version == 0 {
+		if !isPlaintextSession(data) {
+			return nil, fmt.Errorf("error decrypting session of %s: neither a sealed nor a plaintext session", did)
+		}
+
+		if err = store.Save(endpoint, did, data); err != nil {
+			return nil, fmt.Errorf("error migrating plaintext session of %s: %w", did, err)
+		}
+
+		return data, nil
+	}
+
+	if envelope.Version != sessionEnvelopeVersion {
+		return nil, fmt.Errorf("error decrypting session of %s: unsupported version %d", did, envelope.Version)
+	}
+
+	if store.key == nil && envelope.Kdf != kdfScrypt {
+		return nil, fmt.Errorf("error decrypting session of %s: session was not sealed with a passphrase", did)
+	}
+
+	aead, err := store.aead(envelope.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting session of %s: %w", did, err)
+	}
+
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, []byte(endpoint+"|"+did))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting session of %s: %w", did, err)
+	}
+
+	return plaintext, nil
+}
+
+// isPlaintextSession tells whether data is a session saved by an ATPClient.
+func isPlaintextSession(data []byte) bool {
+	var session struct {
+		Did    string
+		Client json.RawMessage
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		return false
+	}
+
+	return session.Did != "" && len(session.Client) > 0 && string(session.Client) != "null"
+}
+
+func (store *EncryptedSessionStore) Save(endpoint, did string, data []byte) error {
+	envelope := sessionEnvelope{Version: sessionEnvelopeVersion}
+
+	if store.key == nil {
+		envelope.Kdf = kdfScrypt
+		envelope.Salt = make([]byte, saltSize)
+		if _, err := rand.Read(envelope.Salt); err != nil {
+			return fmt.Errorf("error encrypting session of %s: %w", did, err)
+		}
+	}
+
+	aead, err := store.aead(envelope.Salt)
+	if err != nil {
+		return fmt.Errorf("error encrypting session of %s: %w", did, err)
+	}
+
+	envelope.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(envelope.Nonce); err != nil {
+		return fmt.Errorf("error encrypting session of %s: %w", did, err)
+	}
+
+	envelope.Ciphertext = aead.Seal(nil, envelope.Nonce, data, []byte(endpoint+"|"+did))
+
+	envelopeJson, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("error encrypting session of %s: %w", did, err)
+	}
+
+	return store.Store.Save(endpoint, did, envelopeJson)
+}
+
+func (store *EncryptedSessionStore) Delete(endpoint, did string) error {
+	return store.Store.Delete(endpoint, did)
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+const testEndpoint = "https://pds.example.com"
+
+var testSession = []byte(`{"Did":"did:plc:testaccount","Client":{"Host":"https://pds.example.com"}}`)
+
+func newTestKeyStore(t *testing.T, store SessionStore, key byte) *EncryptedSessionStore {
+	t.Helper()
+
+	encryptedStore, err := NewEncryptedSessionStore(store, bytes.Repeat([]byte{key}, 32))
+	if err != nil {
+		t.Fatalf("creating encrypted store: %v", err)
+	}
+
+	return encryptedStore
+}
+
+func newTestPassphraseStore(t *testing.T, store SessionStore, passphrase string) *EncryptedSessionStore {
+	t.Helper()
+
+	encryptedStore, err := NewPassphraseSessionStore(store, passphrase)
+	if err != nil {
+		t.Fatalf("creating passphrase store: %v", err)
+	}
+
+	return encryptedStore
+}
+
+func TestEncryptedSessionStoreRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(SessionStore) *EncryptedSessionStore
+	}{
+		{name: "key", store: func(store SessionStore) *EncryptedSessionStore { return newTestKeyStore(t, store, 1) }},
+		{
+			name: "passphrase",
+			store: func(store SessionStore) *EncryptedSessionStore {
+				return newTestPassphraseStore(t, store, "correct horse")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backing := NewMemorySessionStore()
+			store := test.store(backing)
+
+			if err := store.Save(testEndpoint, testDid, testSession); err != nil {
+				t.Fatalf("saving session: %v", err)
+			}
+
+			sealed, err := backing.Load(testEndpoint, testDid)
+			if err != nil {
+				t.Fatalf("loading sealed session: %v", err)
+			}
+			if bytes.Contains(sealed, []byte(testDid)) || bytes.Contains(sealed, []byte("Client")) {
+				t.Errorf("backing store holds the session in the clear: %s", sealed)
+			}
+
+			data, err := store.Load(testEndpoint, testDid)
+			if err != nil {
+				t.Fatalf("loading session: %v", err)
+			}
+			if !bytes.Equal(data, testSession) {
+				t.Errorf("session = %s, want %s", data, testSession)
+			}
+		})
+	}
+}
+
+func TestEncryptedSessionStoreWrongSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		sealer func(SessionStore) *EncryptedSessionStore
+		opener func(SessionStore) *EncryptedSessionStore
+	}{
+		{
+			name:   "wrong key",
+			sealer: func(store SessionStore) *EncryptedSessionStore { return newTestKeyStore(t, store, 1) },
+			opener: func(store SessionStore) *EncryptedSessionStore { return newTestKeyStore(t, store, 2) },
+		},
+		{
+			name: "wrong passphrase",
+			sealer: func(store SessionStore) *EncryptedSessionStore {
+				return newTestPassphraseStore(t, store, "correct horse")
+			},
+			opener: func(store SessionStore) *EncryptedSessionStore {
+				return newTestPassphraseStore(t, store, "battery staple")
+			},
+		},
+		{
+			name:   "passphrase for a key",
+			sealer: func(store SessionStore) *EncryptedSessionStore { return newTestKeyStore(t, store, 1) },
+			opener: func(store SessionStore) *EncryptedSessionStore {
+				return newTestPassphraseStore(t, store, "correct horse")
+			},
+		},
+		{
+			name: "key for a passphrase",
+			sealer: func(store SessionStore) *EncryptedSessionStore {
+				return newTestPassphraseStore(t, store, "correct horse")
+			},
+			opener: func(store SessionStore) *EncryptedSessionStore { return newTestKeyStore(t, store, 1) },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backing := NewMemorySessionStore()
+			if err := test.sealer(backing).Save(testEndpoint, testDid, testSession); err != nil {
+				t.Fatalf("saving session: %v", err)
+			}
+
+			sealed, _ := backing.Load(testEndpoint, testDid)
+
+			if data, err := test.opener(backing).Load(testEndpoint, testDid); err == nil {
+				t.Fatalf("loaded %s with the wrong secret", data)
+			}
+
+			// a failed open must not overwrite what is stored
+			if after, _ := backing.Load(testEndpoint, testDid); !bytes.Equal(after, sealed) {
+				t.Error("sealed session was changed by a failed load")
+			}
+		})
+	}
+}
+
+func TestEncryptedSessionStoreBindsEndpointAndDid(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		did      string
+	}{
+		{name: "other endpoint", endpoint: "https://other.example.com", did: testDid},
+		{name: "other DID", endpoint: testEndpoint, did: "did:plc:otheraccount"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backing := NewMemorySessionStore()
+			store := newTestKeyStore(t, backing, 1)
+
+			if err := store.Save(testEndpoint, testDid, testSession); err != nil {
+				t.Fatalf("saving session: %v", err)
+			}
+
+			// move the sealed session under another key of the backing store
+			sealed, _ := backing.Load(testEndpoint, testDid)
+			if err := backing.Save(test.endpoint, test.did, sealed); err != nil {
+				t.Fatalf("copying sealed session: %v", err)
+			}
+
+			if data, err := store.Load(test.endpoint, test.did); err == nil {
+				t.Fatalf("loaded %s sealed for another endpoint or DID", data)
+			}
+		})
+	}
+}
+
+func TestEncryptedSessionStoreMigratesPlaintext(t *testing.T) {
+	backing := NewMemorySessionStore()
+	if err := backing.Save(testEndpoint, testDid, testSession); err != nil {
+		t.Fatalf("saving plaintext session: %v", err)
+	}
+
+	store := newTestKeyStore(t, backing, 1)
+
+	data, err := store.Load(testEndpoint, testDid)
+	if err != nil {
+		t.Fatalf("loading plaintext session: %v", err)
+	}
+	if !bytes.Equal(data, testSession) {
+		t.Errorf("session = %s, want %s", data, testSession)
+	}
+
+	sealed, _ := backing.Load(testEndpoint, testDid)
+
+	var envelope sessionEnvelope
+	if err = json.Unmarshal(sealed, &envelope); err != nil || envelope.Version != sessionEnvelopeVersion {
+		t.Fatalf("stored session was not sealed: %s", sealed)
+	}
+
+	if data, err = store.Load(testEndpoint, testDid); err != nil || !bytes.Equal(data, testSession) {
+		t.Errorf("loading migrated session = %s, %v", data, err)
+	}
+}
+
+func TestEncryptedSessionStoreRejectsDamagedData(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not JSON", data: []byte("garbage")},
+		{name: "not a session", data: []byte(`{"hello":"world"}`)},
+		{name: "session without client", data: []byte(`{"Did":"did:plc:testaccount","Client":null}`)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backing := NewMemorySessionStore()
+			if err := backing.Save(testEndpoint, testDid, test.data); err != nil {
+				t.Fatalf("saving data: %v", err)
+			}
+
+			if _, err := newTestKeyStore(t, backing, 1).Load(testEndpoint, testDid); err == nil {
+				t.Fatal("loaded damaged data")
+			}
+
+			if after, _ := backing.Load(testEndpoint, testDid); !bytes.Equal(after, test.data) {
+				t.Errorf("damaged data was re-sealed: %s", after)
+			}
+		})
+	}
+}
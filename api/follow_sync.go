@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/suvpen/suvatp/util"
+	"iter"
+	"sort"
+)
+
+// FollowRecord is a follow record of the authenticated account's repo.
+type FollowRecord struct {
+	Subject   string
+	Uri       string
+	RecordKey string
+}
+
+// ListFollowRecordsIter reads the follow records straight from the repo, which is
+// cheaper than going through profiles and also shows follows of deleted accounts.
+func (atpClient *ATPClient) ListFollowRecordsIter(ctx context.Context, opts *PageOptions) iter.Seq2[*FollowRecord, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*FollowRecord, *string, error) {
+			var resp *atproto.RepoListRecords_Output
+			err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+				resp, err = atproto.RepoListRecords(
+					ctx, atpClient.Client, atpClient.Config.GraphFollowLexicon, cursor, limit,
+					atpClient.Client.Auth.Did, false, "", "")
+				return err
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("error listing follow records: %w", err)
+			}
+
+			records := make([]*FollowRecord, 0, len(resp.Records))
+			for _, record := range resp.Records {
+				follow, ok := record.Value.Val.(*bsky.GraphFollow)
+				if !ok {
+					continue
+				}
+
+				records = append(records, &FollowRecord{
+					Subject:   follow.Subject,
+					Uri:       record.Uri,
+					RecordKey: util.GetRecordKeyFromUrlOrAtUri(record.Uri),
+				})
+			}
+
+			return records, resp.Cursor, nil
+		})
+}
+
+type FollowSyncOptions struct {
+	// DryRun computes the changes without writing anything.
+	DryRun bool
+	// KeepExtra leaves follows that are not in the desired set alone.
+	KeepExtra bool
+}
+
+// FollowSyncReport lists what SyncFollows changed, or would change in a dry run.
+// Duplicates are extra follow records of an already followed account.
+type FollowSyncReport struct {
+	DryRun     bool
+	Followed   []string
+	Unfollowed []string
+	Duplicates []string
+	Unchanged  int
+	Unresolved map[string]error
+	Failed     map[string]error
+}
+
+func (atpClient *ATPClient) SyncFollows(desired []string, opts *FollowSyncOptions) (*FollowSyncReport, error) {
+	return atpClient.SyncFollowsContext(context.Background(), desired, opts)
+}
+
+// SyncFollowsContext makes the account follow exactly the desired DIDs and handles.
+// Writes go through the client's rate limiter; a failing write is recorded in the
+// report and does not stop the others. The returned error joins all failures.
+// Nothing is written if any of desired does not resolve.
+func (atpClient *ATPClient) SyncFollowsContext(
+	ctx context.Context, desired []string, opts *FollowSyncOptions) (*FollowSyncReport, error) {
+	if opts == nil {
+		opts = &FollowSyncOptions{}
+	}
+
+	report := &FollowSyncReport{
+		DryRun:     opts.DryRun,
+		Unresolved: make(map[string]error),
+		Failed:     make(map[string]error),
+	}
+
+	want := make(map[string]bool, len(desired))
+	for _, did := range atpClient.resolveDids(ctx, desired, report.Unresolved) {
+		want[did] = true
+	}
+
+	// an unresolved account would look extra and be unfollowed
+	if len(report.Unresolved) > 0 {
+		var errs []error
+		for didOrHandle, err := range report.Unresolved {
+			errs = append(errs, fmt.Errorf("%s: %w", didOrHandle, err))
+		}
+
+		return report, fmt.Errorf("error syncing follows: %w", errors.Join(errs...))
+	}
+
+	have := make(map[string]bool)
+	var unfollow, duplicates []*FollowRecord
+
+	for record, err := range atpClient.ListFollowRecordsIter(ctx, nil) {
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case have[record.Subject]:
+			duplicates = append(duplicates, record)
+		case want[record.Subject]:
+			have[record.Subject] = true
+			report.Unchanged++
+		case !opts.KeepExtra:
+			have[record.Subject] = true
+			unfollow = append(unfollow, record)
+		default:
+			have[record.Subject] = true
+		}
+	}
+
+	var follow []string
+	for did := range want {
+		if !have[did] {
+			follow = append(follow, did)
+		}
+	}
+	sort.Strings(follow)
+
+	for _, did := range follow {
+		if !opts.DryRun {
+			if _, err := atpClient.FollowDidContext(ctx, did); err != nil {
+				report.Failed[did] = err
+				continue
+			}
+		}
+
+		report.Followed = append(report.Followed, did)
+	}
+
+	for _, record := range unfollow {
+		if !opts.DryRun {
+			if err := atpClient.deleteFollowRecord(ctx, record); err != nil {
+				report.Failed[record.Subject] = err
+				continue
+			}
+		}
+
+		report.Unfollowed = append(report.Unfollowed, record.Subject)
+	}
+
+	for _, record := range duplicates {
+		if !opts.DryRun {
+			if err := atpClient.deleteFollowRecord(ctx, record); err != nil {
+				report.Failed[record.Uri] = err
+				continue
+			}
+		}
+
+		report.Duplicates = append(report.Duplicates, record.Uri)
+	}
+
+	var errs []error
+	for subject, err := range report.Failed {
+		errs = append(errs, fmt.Errorf("%s: %w", subject, err))
+	}
+
+	return report, errors.Join(errs...)
+}
+
+func (atpClient *ATPClient) deleteFollowRecord(ctx context.Context, record *FollowRecord) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+			Repo:       atpClient.Client.Auth.Did,
+			Collection: atpClient.Config.GraphFollowLexicon,
+			Rkey:       record.RecordKey,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error unfollowing DID %s: %w", record.Subject, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+const (
+	testFollowA = "did:plc:followa"
+	testFollowB = "did:plc:followb"
+	testFollowC = "did:plc:followc"
+)
+
+// testFollowRepo answers the follow records and handle resolution of the test
+// account in place of the PDS.
+type testFollowRepo struct {
+	mu      sync.Mutex
+	follows []*FollowRecord
+	handles map[string]string
+	writes  int
+	nextKey int
+}
+
+func newTestFollowRepo(subjects ...string) *testFollowRepo {
+	repo := &testFollowRepo{handles: map[string]string{"c.example.com": testFollowC}}
+	for _, subject := range subjects {
+		repo.add(subject)
+	}
+
+	return repo
+}
+
+// add stores a follow of subject; callers hold mu unless the repo is not in use.
+func (repo *testFollowRepo) add(subject string) {
+	repo.nextKey++
+	recordKey := fmt.Sprintf("3kfollow%d", repo.nextKey)
+
+	repo.follows = append(repo.follows, &FollowRecord{
+		Subject:   subject,
+		Uri:       "at://" + testDid + "/app.bsky.graph.follow/" + recordKey,
+		RecordKey: recordKey,
+	})
+}
+
+func (repo *testFollowRepo) subjects() []string {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	subjects := make([]string, 0, len(repo.follows))
+	for _, follow := range repo.follows {
+		subjects = append(subjects, follow.Subject)
+	}
+	sort.Strings(subjects)
+
+	return subjects
+}
+
+func (repo *testFollowRepo) middleware(next http.RoundTripper) http.RoundTripper {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/xrpc/com.atproto.identity.resolveHandle", repo.resolveHandle)
+	mux.HandleFunc("/xrpc/com.atproto.repo.listRecords", repo.listRecords)
+	mux.HandleFunc("/xrpc/com.atproto.repo.createRecord", repo.createRecord)
+	mux.HandleFunc("/xrpc/com.atproto.repo.deleteRecord", repo.deleteRecord)
+
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if _, pattern := mux.Handler(req); pattern == "" {
+			return next.RoundTrip(req)
+		}
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+
+		return recorder.Result(), nil
+	})
+}
+
+func (repo *testFollowRepo) resolveHandle(w http.ResponseWriter, r *http.Request) {
+	did, ok := repo.handles[r.URL.Query().Get("handle")]
+	if !ok {
+		writeXRPCError(w, http.StatusBadRequest, "InvalidRequest", "Unable to resolve handle")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"did": did})
+}
+
+func (repo *testFollowRepo) listRecords(w http.ResponseWriter, r *http.Request) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	records := make([]map[string]any, 0, len(repo.follows))
+	for _, follow := range repo.follows {
+		records = append(records, map[string]any{
+			"uri": follow.Uri,
+			"cid": "bafyreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy",
+			"value": map[string]string{
+				"$type":     "app.bsky.graph.follow",
+				"subject":   follow.Subject,
+				"createdAt": "2024-07-01T00:00:00Z",
+			},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"records": records})
+}
+
+func (repo *testFollowRepo) createRecord(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Record struct {
+			Subject string `json:"subject"`
+		} `json:"record"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeXRPCError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.writes++
+	repo.add(input.Record.Subject)
+	follow := repo.follows[len(repo.follows)-1]
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"uri": follow.Uri,
+		"cid": "bafyreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy",
+	})
+}
+
+func (repo *testFollowRepo) deleteRecord(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Rkey string `json:"rkey"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeXRPCError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.writes++
+	for i, follow := range repo.follows {
+		if follow.RecordKey == input.Rkey {
+			repo.follows = append(repo.follows[:i], repo.follows[i+1:]...)
+			break
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{})
+}
+
+func TestSyncFollows(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired []string
+		opts    *FollowSyncOptions
+
+		wantErr        bool
+		wantFollowed   []string
+		wantUnfollowed []string
+		wantDuplicates []string
+		wantUnchanged  int
+		wantUnresolved []string
+		wantSubjects   []string
+		wantWrites     int
+	}{
+		{
+			name:           "sync",
+			desired:        []string{testFollowA, "c.example.com"},
+			wantFollowed:   []string{testFollowC},
+			wantUnfollowed: []string{testFollowB},
+			wantDuplicates: []string{"at://" + testDid + "/app.bsky.graph.follow/3kfollow3"},
+			wantUnchanged:  1,
+			wantSubjects:   []string{testFollowA, testFollowC},
+			wantWrites:     3,
+		},
+		{
+			name:           "dry run",
+			desired:        []string{testFollowA, "c.example.com"},
+			opts:           &FollowSyncOptions{DryRun: true},
+			wantFollowed:   []string{testFollowC},
+			wantUnfollowed: []string{testFollowB},
+			wantDuplicates: []string{"at://" + testDid + "/app.bsky.graph.follow/3kfollow3"},
+			wantUnchanged:  1,
+			wantSubjects:   []string{testFollowA, testFollowB, testFollowB},
+		},
+		{
+			name:           "keep extra",
+			desired:        []string{testFollowA, "c.example.com"},
+			opts:           &FollowSyncOptions{KeepExtra: true},
+			wantFollowed:   []string{testFollowC},
+			wantDuplicates: []string{"at://" + testDid + "/app.bsky.graph.follow/3kfollow3"},
+			wantUnchanged:  1,
+			wantSubjects:   []string{testFollowA, testFollowB, testFollowC},
+			wantWrites:     2,
+		},
+		{
+			name:           "unresolved",
+			desired:        []string{testFollowA, "c.example.com", "gone.example.com"},
+			wantErr:        true,
+			wantUnresolved: []string{"gone.example.com"},
+			wantSubjects:   []string{testFollowA, testFollowB, testFollowB},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pds := newTestPDS(t)
+			repo := newTestFollowRepo(testFollowA, testFollowB, testFollowB)
+
+			atpClient, err := ClientContext(context.Background(), testDid, testAppPassword, newTestConfig(pds.URL),
+				WithSessionStore(NewMemorySessionStore()), WithMiddleware(repo.middleware))
+			if err != nil {
+				t.Fatalf("creating client: %v", err)
+			}
+
+			report, err := atpClient.SyncFollowsContext(context.Background(), test.desired, test.opts)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, want error %t", err, test.wantErr)
+			}
+
+			var unresolved []string
+			for didOrHandle := range report.Unresolved {
+				unresolved = append(unresolved, didOrHandle)
+			}
+
+			got := []struct {
+				name      string
+				got, want any
+			}{
+				{"followed", report.Followed, test.wantFollowed},
+				{"unfollowed", report.Unfollowed, test.wantUnfollowed},
+				{"duplicates", report.Duplicates, test.wantDuplicates},
+				{"unchanged", report.Unchanged, test.wantUnchanged},
+				{"unresolved", unresolved, test.wantUnresolved},
+				{"follows", repo.subjects(), test.wantSubjects},
+				{"writes", repo.writes, test.wantWrites},
+			}
+			for _, field := range got {
+				if !reflect.DeepEqual(field.got, field.want) {
+					t.Errorf("%s = %v, want %v", field.name, field.got, field.want)
+				}
+			}
+
+			if report.DryRun != (test.opts != nil && test.opts.DryRun) {
+				t.Errorf("report.DryRun = %t", report.DryRun)
+			}
+			if len(report.Failed) != 0 {
+				t.Errorf("failed = %v", report.Failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"iter"
+)
+
+// maxRelationshipsPerRequest is the most actors app.bsky.graph.getRelationships accepts.
+const maxRelationshipsPerRequest = 30
+
+func (atpClient *ATPClient) GetActorFollows(didOrHandle, cursor string, limit int64) (*bsky.GraphGetFollows_Output, error) {
+	return atpClient.GetActorFollowsContext(context.Background(), didOrHandle, cursor, limit)
+}
+
+func (atpClient *ATPClient) GetActorFollowsContext(
+	ctx context.Context, didOrHandle, cursor string, limit int64) (*bsky.GraphGetFollows_Output, error) {
+	var follows *bsky.GraphGetFollows_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		follows, err = bsky.GraphGetFollows(ctx, atpClient.Client, didOrHandle, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting follows of %s: %w", didOrHandle, err)
+	}
+
+	return follows, nil
+}
+
+func (atpClient *ATPClient) GetFollowers(didOrHandle, cursor string, limit int64) (*bsky.GraphGetFollowers_Output, error) {
+	return atpClient.GetFollowersContext(context.Background(), didOrHandle, cursor, limit)
+}
+
+func (atpClient *ATPClient) GetFollowersContext(
+	ctx context.Context, didOrHandle, cursor string, limit int64) (*bsky.GraphGetFollowers_Output, error) {
+	var followers *bsky.GraphGetFollowers_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		followers, err = bsky.GraphGetFollowers(ctx, atpClient.Client, didOrHandle, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting followers of %s: %w", didOrHandle, err)
+	}
+
+	return followers, nil
+}
+
+func (atpClient *ATPClient) GetKnownFollowers(didOrHandle, cursor string, limit int64) (*bsky.GraphGetKnownFollowers_Output, error) {
+	return atpClient.GetKnownFollowersContext(context.Background(), didOrHandle, cursor, limit)
+}
+
+// GetKnownFollowersContext returns the followers of an actor that the authenticated
+// account follows too.
+func (atpClient *ATPClient) GetKnownFollowersContext(
+	ctx context.Context, didOrHandle, cursor string, limit int64) (*bsky.GraphGetKnownFollowers_Output, error) {
+	var followers *bsky.GraphGetKnownFollowers_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		followers, err = bsky.GraphGetKnownFollowers(ctx, atpClient.Client, didOrHandle, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting known followers of %s: %w", didOrHandle, err)
+	}
+
+	return followers, nil
+}
+
+func (atpClient *ATPClient) GetRelationships(
+	didOrHandle string, others []string) ([]*bsky.GraphGetRelationships_Output_Relationships_Elem, error) {
+	return atpClient.GetRelationshipsContext(context.Background(), didOrHandle, others)
+}
+
+// GetRelationshipsContext returns the follow relationships between an actor and each
+// of others, splitting them into as many requests as needed.
+func (atpClient *ATPClient) GetRelationshipsContext(
+	ctx context.Context, didOrHandle string,
+	others []string) ([]*bsky.GraphGetRelationships_Output_Relationships_Elem, error) {
+	relationships := make([]*bsky.GraphGetRelationships_Output_Relationships_Elem, 0, len(others))
+
+	for start := 0; start < len(others); start += maxRelationshipsPerRequest {
+		batch := others[start:min(start+maxRelationshipsPerRequest, len(others))]
+
+		var resp *bsky.GraphGetRelationships_Output
+		err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+			resp, err = bsky.GraphGetRelationships(ctx, atpClient.Client, didOrHandle, batch)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting relationships of %s: %w", didOrHandle, err)
+		}
+
+		relationships = append(relationships, resp.Relationships...)
+	}
+
+	return relationships, nil
+}
+
+func (atpClient *ATPClient) GetActorFollowsIter(
+	ctx context.Context, didOrHandle string, opts *PageOptions) iter.Seq2[*bsky.ActorDefs_ProfileView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.ActorDefs_ProfileView, *string, error) {
+			resp, err := atpClient.GetActorFollowsContext(ctx, didOrHandle, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Follows, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) GetFollowersIter(
+	ctx context.Context, didOrHandle string, opts *PageOptions) iter.Seq2[*bsky.ActorDefs_ProfileView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.ActorDefs_ProfileView, *string, error) {
+			resp, err := atpClient.GetFollowersContext(ctx, didOrHandle, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Followers, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) GetKnownFollowersIter(
+	ctx context.Context, didOrHandle string, opts *PageOptions) iter.Seq2[*bsky.ActorDefs_ProfileView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.ActorDefs_ProfileView, *string, error) {
+			resp, err := atpClient.GetKnownFollowersContext(ctx, didOrHandle, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Followers, resp.Cursor, nil
+		})
+}
+
+// FollowGraph splits the follow graph of an account: Mutuals follow each other with
+// it, NonFollowbacks are followed by it without following back, and Fans follow it
+// without being followed back.
+type FollowGraph struct {
+	Mutuals        []*bsky.ActorDefs_ProfileView
+	NonFollowbacks []*bsky.ActorDefs_ProfileView
+	Fans           []*bsky.ActorDefs_ProfileView
+}
+
+func (atpClient *ATPClient) GetFollowGraph(didOrHandle string) (*FollowGraph, error) {
+	return atpClient.GetFollowGraphContext(context.Background(), didOrHandle)
+}
+
+// GetFollowGraphContext reads all follows and followers of an account, so it takes
+// one request per hundred of each.
+func (atpClient *ATPClient) GetFollowGraphContext(ctx context.Context, didOrHandle string) (*FollowGraph, error) {
+	followers := make(map[string]bool)
+	var followerProfiles []*bsky.ActorDefs_ProfileView
+
+	for follower, err := range atpClient.GetFollowersIter(ctx, didOrHandle, nil) {
+		if err != nil {
+			return nil, err
+		}
+
+		followers[follower.Did] = true
+		followerProfiles = append(followerProfiles, follower)
+	}
+
+	graph := &FollowGraph{}
+	follows := make(map[string]bool)
+
+	for follow, err := range atpClient.GetActorFollowsIter(ctx, didOrHandle, nil) {
+		if err != nil {
+			return nil, err
+		}
+
+		follows[follow.Did] = true
+		if followers[follow.Did] {
+			graph.Mutuals = append(graph.Mutuals, follow)
+		} else {
+			graph.NonFollowbacks = append(graph.NonFollowbacks, follow)
+		}
+	}
+
+	for _, follower := range followerProfiles {
+		if !follows[follower.Did] {
+			graph.Fans = append(graph.Fans, follower)
+		}
+	}
+
+	return graph, nil
+}
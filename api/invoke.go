@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/suvpen/suvatp/atperr"
+)
+
+// invoke runs call under the configured RetryPolicy, renewing the session and
+// replaying once when the access token has expired. call receives a context that
+// must be used for the request so the Retry-After of its response can be observed.
+// XRPC failures are returned as *atperr.ATPError tagged with the endpoint NSID.
+// Retry state is local to each invocation, so concurrent calls never share a budget.
+// Waits for rate limit budgets and between retries happen without the session lock.
+func (atpClient *ATPClient) invoke(ctx context.Context, call func(ctx context.Context) error) error {
+	policy := atpClient.Config.retryPolicy()
+
+	var retries int
+	var renewed bool
+	charged := make(map[string]bool)
+
+	for {
+		callCtx, hint := withRetryHint(ctx, charged)
+
+		atpClient.mu.RLock()
+		accessJwt := atpClient.Client.Auth.AccessJwt
+		err := atperr.FromError(call(callCtx), hint.endpoint)
+		atpClient.mu.RUnlock()
+
+		if err == nil {
+			return nil
+		}
+
+		// the request was held back for a rate limit budget; wait for it unlocked so
+		// renewals and other calls are not blocked meanwhile
+		if hint.pace > 0 {
+			if sleepErr := sleepContext(ctx, hint.pace); sleepErr != nil {
+				return sleepErr
+			}
+
+			continue
+		}
+
+		if atpClient.tokenExpired(err) && !renewed {
+			renewed = true
+
+			if renewErr := atpClient.renewSession(ctx, accessJwt); renewErr != nil {
+				return errors.Join(err, renewErr)
+			}
+
+			continue
+		}
+
+		if !policy.retryable(err) || retries+1 >= policy.MaxAttempts {
+			return err
+		}
+
+		retries++
+
+		wait, ok := policy.delay(retries, err, hint)
+		if !ok {
+			return err
+		}
+
+		if sleepErr := sleepContext(ctx, wait); sleepErr != nil {
+			return errors.Join(err, sleepErr)
+		}
+	}
+}
+
+// renewSession refreshes the session with the refresh JWT and falls back to signing
+// in again with the app password when the refresh token itself is no longer valid.
+// Callers pass the access JWT that was rejected; if another goroutine has already
+// replaced it, the renewal is skipped so the single-use refresh JWT is not spent twice.
+func (atpClient *ATPClient) renewSession(ctx context.Context, staleAccessJwt string) error {
+	atpClient.mu.Lock()
+	defer atpClient.mu.Unlock()
+
+	if atpClient.Client.Auth.AccessJwt != staleAccessJwt {
+		return nil
+	}
+
+	if atpClient.IsOAuth() {
+		return atpClient.refreshOAuth(ctx)
+	}
+
+	_, err := refreshSession(ctx, atpClient)
+	if err == nil {
+		return nil
+	}
+
+	if !(atperr.IsTokenExpiredError(err) || atperr.IsTokenRevokedError(err)) || atpClient.AppPassword == "" {
+		return fmt.Errorf("error refreshing session of %s: %w", atpClient.Did, err)
+	}
+
+	unauthenticated := *atpClient.Client
+	unauthenticated.Auth = nil
+
+	session, err := signIn(ctx, &unauthenticated, atpClient.Did, atpClient.AppPassword, "", atpClient.authFactorPrompt)
+	if err != nil {
+		return fmt.Errorf("error signing in again as %s: %w", atpClient.Did, err)
+	}
+
+	atpClient.setAuth(session.AccessJwt, session.RefreshJwt, session.Handle, session.Did)
+
+	return atpClient.saveSession()
+}
@@ -0,0 +1,380 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/api/chat"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testDid         = "did:plc:testaccount"
+	testHandle      = "test.example.com"
+	testAppPassword = "aaaa-bbbb-cccc-dddd"
+)
+
+// testPDS is a stand-in PDS that hands out one access JWT at a time. Once expire is
+// called, every request made with that JWT fails with ExpiredToken until the
+// session is refreshed.
+type testPDS struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	generation int
+	accessJwt  string
+	refreshJwt string
+
+	// expireAfter is the number of authenticated requests after which the access
+	// JWT is expired; zero never expires it
+	expireAfter int64
+
+	requests  atomic.Int64
+	signIns   atomic.Int64
+	refreshes atomic.Int64
+	posts     atomic.Int64
+	reads     atomic.Int64
+	messages  atomic.Int64
+}
+
+func newTestPDS(t *testing.T) *testPDS {
+	t.Helper()
+
+	pds := &testPDS{}
+	pds.issue()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/xrpc/com.atproto.server.createSession", pds.createSession)
+	mux.HandleFunc("/xrpc/com.atproto.server.refreshSession", pds.refreshSession)
+	mux.HandleFunc("/xrpc/com.atproto.repo.createRecord", pds.authenticated(pds.createRecord))
+	mux.HandleFunc("/xrpc/com.atproto.repo.getRecord", pds.authenticated(pds.getRecord))
+	mux.HandleFunc("/xrpc/chat.bsky.convo.sendMessage", pds.authenticated(pds.sendMessage))
+
+	pds.Server = httptest.NewServer(mux)
+	t.Cleanup(pds.Close)
+
+	return pds
+}
+
+func testJWT(subject string, generation int) string {
+	encode := func(v any) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	header := encode(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload := encode(map[string]any{
+		"sub": subject,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(2 * time.Hour).Unix(),
+		"jti": generation,
+	})
+
+	return header + "." + payload + ".c2lnbmF0dXJl"
+}
+
+// issue replaces the session tokens; callers hold mu unless the server is not running.
+func (pds *testPDS) issue() {
+	pds.generation++
+	pds.accessJwt = testJWT(testDid, pds.generation)
+	pds.refreshJwt = fmt.Sprintf("refresh-%d", pds.generation)
+}
+
+func (pds *testPDS) expire() {
+	pds.mu.Lock()
+	defer pds.mu.Unlock()
+
+	pds.accessJwt = ""
+}
+
+func (pds *testPDS) session() map[string]any {
+	return map[string]any{
+		"accessJwt":  pds.accessJwt,
+		"refreshJwt": pds.refreshJwt,
+		"handle":     testHandle,
+		"did":        testDid,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeXRPCError(w http.ResponseWriter, status int, name, message string) {
+	writeJSON(w, status, map[string]string{"error": name, "message": message})
+}
+
+func bearer(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func (pds *testPDS) createSession(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Identifier string `json:"identifier"`
+		Password   string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil ||
+		input.Identifier != testDid || input.Password != testAppPassword {
+		writeXRPCError(w, http.StatusUnauthorized, "AuthenticationRequired", "Invalid identifier or password")
+		return
+	}
+
+	pds.signIns.Add(1)
+
+	pds.mu.Lock()
+	pds.issue()
+	session := pds.session()
+	pds.mu.Unlock()
+
+	session["didDoc"] = map[string]any{
+		"@context":    []string{"https://www.w3.org/ns/did/v1"},
+		"id":          testDid,
+		"alsoKnownAs": []string{"at://" + testHandle},
+		"service": []map[string]string{{
+			"id":              "#atproto_pds",
+			"type":            "AtprotoPersonalDataServer",
+			"serviceEndpoint": pds.URL,
+		}},
+	}
+
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (pds *testPDS) refreshSession(w http.ResponseWriter, r *http.Request) {
+	pds.mu.Lock()
+	defer pds.mu.Unlock()
+
+	// refresh JWTs are single use, as on a real PDS
+	if bearer(r) != pds.refreshJwt {
+		writeXRPCError(w, http.StatusBadRequest, "ExpiredToken", "Token has expired")
+		return
+	}
+
+	pds.refreshes.Add(1)
+
+	// give concurrent callers time to run into the expired token as well
+	time.Sleep(20 * time.Millisecond)
+
+	pds.issue()
+	writeJSON(w, http.StatusOK, pds.session())
+}
+
+func (pds *testPDS) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pds.mu.Lock()
+		valid := pds.accessJwt != "" && bearer(r) == pds.accessJwt
+		pds.mu.Unlock()
+
+		if !valid {
+			writeXRPCError(w, http.StatusBadRequest, "ExpiredToken", "Token has expired")
+			return
+		}
+
+		if n := pds.requests.Add(1); n == pds.expireAfter {
+			pds.expire()
+		}
+
+		next(w, r)
+	}
+}
+
+func (pds *testPDS) createRecord(w http.ResponseWriter, r *http.Request) {
+	pds.posts.Add(1)
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"uri": "at://" + testDid + "/app.bsky.feed.post/3kabcdefghijk",
+		"cid": "bafyreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy",
+	})
+}
+
+func (pds *testPDS) getRecord(w http.ResponseWriter, r *http.Request) {
+	pds.reads.Add(1)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"uri": "at://" + testDid + "/app.bsky.feed.post/" + r.URL.Query().Get("rkey"),
+		"cid": "bafyreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy",
+		"value": map[string]string{
+			"$type":     "app.bsky.feed.post",
+			"text":      "hello",
+			"createdAt": time.Now().Format(time.RFC3339),
+		},
+	})
+}
+
+func (pds *testPDS) sendMessage(w http.ResponseWriter, r *http.Request) {
+	pds.messages.Add(1)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":     "3kmessage",
+		"rev":    "3krev",
+		"text":   "hello",
+		"sender": map[string]string{"did": testDid},
+		"sentAt": time.Now().Format(time.RFC3339),
+	})
+}
+
+func newTestConfig(endpoint string) *Config {
+	return &Config{
+		ATProtoEndpoint:    endpoint,
+		ProfilesCollection: DefaultProfilesCollection,
+		PostsCollection:    DefaultPostsCollection,
+		RepostsCollection:  DefaultRepostsCollection,
+		LikesCollection:    DefaultLikeCollection,
+		GraphFollowLexicon: DefaultGraphFollowLexicon,
+		GraphBlockLexicon:  DefaultGraphBlockLexicon,
+		LabelerService:     DefaultLabelerService,
+		Retries:            DefaultRetries,
+	}
+}
+
+func newTestClient(t *testing.T, pds *testPDS) *ATPClient {
+	t.Helper()
+
+	atpClient, err := ClientContext(context.Background(), testDid, testAppPassword, newTestConfig(pds.URL),
+		WithSessionStore(NewMemorySessionStore()))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	return atpClient
+}
+
+func TestConcurrentCallsRenewSessionOnce(t *testing.T) {
+	pds := newTestPDS(t)
+	atpClient := newTestClient(t, pds)
+
+	const workers = 8
+	const rounds = 3
+
+	// expire the access JWT while the workers are in the middle of their calls
+	pds.expireAfter = workers
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*rounds*3)
+
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for round := 0; round < rounds; round++ {
+				if _, err := atpClient.Post(&bsky.FeedPost{
+					Text:      "hello",
+					CreatedAt: time.Now().Format(time.RFC3339),
+				}); err != nil {
+					errs <- fmt.Errorf("post: %w", err)
+				}
+
+				if _, err := atpClient.GetPost(testDid, "3kabcdefghijk"); err != nil {
+					errs <- fmt.Errorf("get post: %w", err)
+				}
+
+				if _, err := atpClient.SendMessage(&chat.ConvoSendMessage_Input{
+					ConvoId: "3kconvo",
+					Message: &chat.ConvoDefs_MessageInput{Text: "hello"},
+				}); err != nil {
+					errs <- fmt.Errorf("send message: %w", err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("call failed: %v", err)
+	}
+
+	for name, got := range map[string]int64{
+		"posts":    pds.posts.Load(),
+		"reads":    pds.reads.Load(),
+		"messages": pds.messages.Load(),
+	} {
+		if got != workers*rounds {
+			t.Errorf("%s served = %d, want %d", name, got, workers*rounds)
+		}
+	}
+
+	if got := pds.refreshes.Load(); got != 1 {
+		t.Errorf("session refreshed %d times, want 1", got)
+	}
+	if got := pds.signIns.Load(); got != 1 {
+		t.Errorf("signed in %d times, want 1", got)
+	}
+}
+
+func TestRenewSessionSkipsReplacedToken(t *testing.T) {
+	pds := newTestPDS(t)
+	atpClient := newTestClient(t, pds)
+
+	atpClient.mu.RLock()
+	staleAccessJwt := atpClient.Client.Auth.AccessJwt
+	atpClient.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := atpClient.renewSession(context.Background(), staleAccessJwt); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("renewing session: %v", err)
+	}
+
+	if got := pds.refreshes.Load(); got != 1 {
+		t.Errorf("session refreshed %d times, want 1", got)
+	}
+
+	atpClient.mu.RLock()
+	defer atpClient.mu.RUnlock()
+
+	if atpClient.Client.Auth.AccessJwt == staleAccessJwt {
+		t.Error("access JWT was not replaced")
+	}
+	if atpClient.PdsClient.Auth.AccessJwt != atpClient.Client.Auth.AccessJwt {
+		t.Error("PDS client was left with another access JWT")
+	}
+}
+
+func TestRenewSessionSignsInAgainWhenRefreshFails(t *testing.T) {
+	pds := newTestPDS(t)
+	atpClient := newTestClient(t, pds)
+
+	pds.mu.Lock()
+	pds.refreshJwt = "revoked"
+	pds.mu.Unlock()
+	pds.expire()
+
+	if _, err := atpClient.GetPost(testDid, "3kabcdefghijk"); err != nil {
+		t.Fatalf("getting post: %v", err)
+	}
+
+	if got := pds.refreshes.Load(); got != 0 {
+		t.Errorf("session refreshed %d times, want 0", got)
+	}
+	if got := pds.signIns.Load(); got != 2 {
+		t.Errorf("signed in %d times, want 2", got)
+	}
+}
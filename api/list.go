@@ -0,0 +1,539 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/suvpen/suvatp/util"
+	"iter"
+	"time"
+)
+
+const (
+	ListPurposeModeration = "app.bsky.graph.defs#modlist"
+	ListPurposeCuration   = "app.bsky.graph.defs#curatelist"
+)
+
+var (
+	ErrInvalidListPurpose = errors.New("invalid list purpose")
+	ErrNotOwnRecord       = errors.New("record is not in the authenticated account's repo")
+)
+
+// ListUpdate holds the changes UpdateList makes to a list; nil fields are left as
+// they are. RemoveAvatar drops the avatar unless a new Avatar is given.
+type ListUpdate struct {
+	Name         *string
+	Description  *string
+	Avatar       []byte
+	RemoveAvatar bool
+}
+
+// ListItemRecord is a list item record of the authenticated account's repo.
+type ListItemRecord struct {
+	List      string
+	Subject   string
+	Uri       string
+	RecordKey string
+}
+
+// ListBlockRecord is a moderation list subscription of the authenticated account's repo.
+type ListBlockRecord struct {
+	List      string
+	Uri       string
+	RecordKey string
+}
+
+func (atpClient *ATPClient) CreateList(purpose, name, description string, avatar []byte) (*atproto.RepoCreateRecord_Output, error) {
+	return atpClient.CreateListContext(context.Background(), purpose, name, description, avatar)
+}
+
+// CreateListContext creates a moderation or curation list. An empty description
+// or a nil avatar is left out of the record.
+func (atpClient *ATPClient) CreateListContext(
+	ctx context.Context, purpose, name, description string, avatar []byte) (*atproto.RepoCreateRecord_Output, error) {
+	if purpose != ListPurposeModeration && purpose != ListPurposeCuration {
+		return nil, fmt.Errorf("error creating list %s: %w: %q", name, ErrInvalidListPurpose, purpose)
+	}
+
+	list := &bsky.GraphList{
+		LexiconTypeID: GraphListLexicon,
+		CreatedAt:     time.Now().Local().Format(time.RFC3339),
+		Name:          name,
+		Purpose:       &purpose,
+	}
+	if description != "" {
+		list.Description = &description
+	}
+
+	if avatar != nil {
+		blob, err := atpClient.UploadBlobContext(ctx, avatar)
+		if err != nil {
+			return nil, fmt.Errorf("error creating list %s: %w", name, err)
+		}
+
+		list.Avatar = blob
+	}
+
+	var resp *atproto.RepoCreateRecord_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: GraphListLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Record:     &lexutil.LexiconTypeDecoder{Val: list},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating list %s: %w", name, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) UpdateList(listUri string, update *ListUpdate) (*atproto.RepoPutRecord_Output, error) {
+	return atpClient.UpdateListContext(context.Background(), listUri, update)
+}
+
+// UpdateListContext rewrites the list record with the changes of update. The write
+// fails if the list was changed in the meantime.
+func (atpClient *ATPClient) UpdateListContext(
+	ctx context.Context, listUri string, update *ListUpdate) (*atproto.RepoPutRecord_Output, error) {
+	if update == nil {
+		update = &ListUpdate{}
+	}
+
+	rKey, err := atpClient.ownRecordKey(listUri, GraphListLexicon)
+	if err != nil {
+		return nil, fmt.Errorf("error updating list %s: %w", listUri, err)
+	}
+
+	var record *atproto.RepoGetRecord_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		record, err = atproto.RepoGetRecord(
+			ctx, atpClient.Client, "", GraphListLexicon, atpClient.Client.Auth.Did, rKey)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error updating list %s: %w", listUri, err)
+	}
+
+	list, ok := record.Value.Val.(*bsky.GraphList)
+	if !ok {
+		return nil, fmt.Errorf("error updating list %s: unexpected record type %T", listUri, record.Value.Val)
+	}
+
+	if update.Name != nil {
+		list.Name = *update.Name
+	}
+	if update.Description != nil {
+		list.Description = update.Description
+		if *update.Description == "" {
+			list.Description = nil
+		}
+		list.DescriptionFacets = nil
+	}
+	if update.RemoveAvatar {
+		list.Avatar = nil
+	}
+	if update.Avatar != nil {
+		blob, err := atpClient.UploadBlobContext(ctx, update.Avatar)
+		if err != nil {
+			return nil, fmt.Errorf("error updating list %s: %w", listUri, err)
+		}
+
+		list.Avatar = blob
+	}
+
+	var resp *atproto.RepoPutRecord_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoPutRecord(ctx, atpClient.Client, &atproto.RepoPutRecord_Input{
+			Collection: GraphListLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Rkey:       rKey,
+			Record:     &lexutil.LexiconTypeDecoder{Val: list},
+			SwapRecord: record.Cid,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error updating list %s: %w", listUri, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) DeleteList(listUri string) error {
+	return atpClient.DeleteListContext(context.Background(), listUri)
+}
+
+// DeleteListContext deletes the items of the list in applyWrites batches, and then
+// the list itself.
+func (atpClient *ATPClient) DeleteListContext(ctx context.Context, listUri string) error {
+	rKey, err := atpClient.ownRecordKey(listUri, GraphListLexicon)
+	if err != nil {
+		return fmt.Errorf("error deleting list %s: %w", listUri, err)
+	}
+
+	var items []*ListItemRecord
+	for record, err := range atpClient.ListListItemRecordsIter(ctx, nil) {
+		if err != nil {
+			return fmt.Errorf("error deleting list %s: %w", listUri, err)
+		}
+
+		if record.List == listUri {
+			items = append(items, record)
+		}
+	}
+
+	for start := 0; start < len(items); start += maxWritesPerApplyWrites {
+		batch := items[start:min(start+maxWritesPerApplyWrites, len(items))]
+
+		writes := make([]*atproto.RepoApplyWrites_Input_Writes_Elem, 0, len(batch))
+		for _, item := range batch {
+			writes = append(writes, &atproto.RepoApplyWrites_Input_Writes_Elem{
+				RepoApplyWrites_Delete: &atproto.RepoApplyWrites_Delete{
+					Collection: GraphListItemLexicon,
+					Rkey:       item.RecordKey,
+				},
+			})
+		}
+
+		if err = atpClient.applyWrites(ctx, writes); err != nil {
+			return fmt.Errorf("error deleting list %s: %w", listUri, err)
+		}
+	}
+
+	err = atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+			Collection: GraphListLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Rkey:       rKey,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting list %s: %w", listUri, err)
+	}
+
+	return nil
+}
+
+// ownRecordKey returns the record key of uri after checking that the record is in
+// collection of the authenticated account's repo, as the writes made with the key
+// always target that repo.
+func (atpClient *ATPClient) ownRecordKey(uri, collection string) (string, error) {
+	record, err := util.DecodeGraphRecord(uri)
+	if err != nil {
+		return "", err
+	}
+
+	atpClient.mu.RLock()
+	did := atpClient.Client.Auth.Did
+	atpClient.mu.RUnlock()
+
+	if record.Did != did || record.Schema != collection {
+		return "", fmt.Errorf("%w: %s", ErrNotOwnRecord, uri)
+	}
+
+	return record.RecordKey, nil
+}
+
+func (atpClient *ATPClient) AddListMember(listUri, didOrHandle string) (*atproto.RepoCreateRecord_Output, error) {
+	return atpClient.AddListMemberContext(context.Background(), listUri, didOrHandle)
+}
+
+func (atpClient *ATPClient) AddListMemberContext(
+	ctx context.Context, listUri, didOrHandle string) (*atproto.RepoCreateRecord_Output, error) {
+	did, err := atpClient.resolveDid(ctx, didOrHandle)
+	if err != nil {
+		return nil, fmt.Errorf("error adding %s to list %s: %w", didOrHandle, listUri, err)
+	}
+
+	var resp *atproto.RepoCreateRecord_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: GraphListItemLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{
+				Val: &bsky.GraphListitem{
+					LexiconTypeID: GraphListItemLexicon,
+					CreatedAt:     time.Now().Local().Format(time.RFC3339),
+					List:          listUri,
+					Subject:       did,
+				},
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error adding %s to list %s: %w", didOrHandle, listUri, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) RemoveListMember(listUri, didOrHandle string) error {
+	return atpClient.RemoveListMemberContext(context.Background(), listUri, didOrHandle)
+}
+
+// RemoveListMemberContext deletes every item of the list for the account. It is not
+// an error if the account is not on the list.
+func (atpClient *ATPClient) RemoveListMemberContext(ctx context.Context, listUri, didOrHandle string) error {
+	did, err := atpClient.resolveDid(ctx, didOrHandle)
+	if err != nil {
+		return fmt.Errorf("error removing %s from list %s: %w", didOrHandle, listUri, err)
+	}
+
+	var items []*ListItemRecord
+	for record, err := range atpClient.ListListItemRecordsIter(ctx, nil) {
+		if err != nil {
+			return fmt.Errorf("error removing %s from list %s: %w", didOrHandle, listUri, err)
+		}
+
+		if record.List == listUri && record.Subject == did {
+			items = append(items, record)
+		}
+	}
+
+	for _, item := range items {
+		err = atpClient.invoke(ctx, func(ctx context.Context) error {
+			return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+				Collection: GraphListItemLexicon,
+				Repo:       atpClient.Client.Auth.Did,
+				Rkey:       item.RecordKey,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("error removing %s from list %s: %w", didOrHandle, listUri, err)
+		}
+	}
+
+	return nil
+}
+
+// ListListItemRecordsIter reads the list item records of every list straight from
+// the repo, including items of deleted accounts.
+func (atpClient *ATPClient) ListListItemRecordsIter(ctx context.Context, opts *PageOptions) iter.Seq2[*ListItemRecord, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*ListItemRecord, *string, error) {
+			var resp *atproto.RepoListRecords_Output
+			err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+				resp, err = atproto.RepoListRecords(
+					ctx, atpClient.Client, GraphListItemLexicon, cursor, limit,
+					atpClient.Client.Auth.Did, false, "", "")
+				return err
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("error listing list item records: %w", err)
+			}
+
+			records := make([]*ListItemRecord, 0, len(resp.Records))
+			for _, record := range resp.Records {
+				item, ok := record.Value.Val.(*bsky.GraphListitem)
+				if !ok {
+					continue
+				}
+
+				records = append(records, &ListItemRecord{
+					List:      item.List,
+					Subject:   item.Subject,
+					Uri:       record.Uri,
+					RecordKey: util.GetRecordKeyFromUrlOrAtUri(record.Uri),
+				})
+			}
+
+			return records, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) GetList(listUri, cursor string, limit int64) (*bsky.GraphGetList_Output, error) {
+	return atpClient.GetListContext(context.Background(), listUri, cursor, limit)
+}
+
+func (atpClient *ATPClient) GetListContext(
+	ctx context.Context, listUri, cursor string, limit int64) (*bsky.GraphGetList_Output, error) {
+	var resp *bsky.GraphGetList_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.GraphGetList(ctx, atpClient.Client, cursor, limit, listUri)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting list %s: %w", listUri, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) GetListMembersIter(
+	ctx context.Context, listUri string, opts *PageOptions) iter.Seq2[*bsky.GraphDefs_ListItemView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.GraphDefs_ListItemView, *string, error) {
+			resp, err := atpClient.GetListContext(ctx, listUri, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Items, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) GetLists(didOrHandle, cursor string, limit int64) (*bsky.GraphGetLists_Output, error) {
+	return atpClient.GetListsContext(context.Background(), didOrHandle, cursor, limit)
+}
+
+// GetListsContext returns the lists created by an actor.
+func (atpClient *ATPClient) GetListsContext(
+	ctx context.Context, didOrHandle, cursor string, limit int64) (*bsky.GraphGetLists_Output, error) {
+	var resp *bsky.GraphGetLists_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.GraphGetLists(ctx, atpClient.Client, didOrHandle, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting lists of %s: %w", didOrHandle, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) GetListsIter(
+	ctx context.Context, didOrHandle string, opts *PageOptions) iter.Seq2[*bsky.GraphDefs_ListView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.GraphDefs_ListView, *string, error) {
+			resp, err := atpClient.GetListsContext(ctx, didOrHandle, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Lists, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) SubscribeModList(listUri string) (*atproto.RepoCreateRecord_Output, error) {
+	return atpClient.SubscribeModListContext(context.Background(), listUri)
+}
+
+// SubscribeModListContext blocks every account of the moderation list at listUri,
+// including the ones added to it later.
+func (atpClient *ATPClient) SubscribeModListContext(ctx context.Context, listUri string) (*atproto.RepoCreateRecord_Output, error) {
+	var resp *atproto.RepoCreateRecord_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: GraphListBlockLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{
+				Val: &bsky.GraphListblock{
+					LexiconTypeID: GraphListBlockLexicon,
+					CreatedAt:     time.Now().Local().Format(time.RFC3339),
+					Subject:       listUri,
+				},
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error subscribing to list %s: %w", listUri, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) UnsubscribeModList(listUri string) error {
+	return atpClient.UnsubscribeModListContext(context.Background(), listUri)
+}
+
+// UnsubscribeModListContext deletes every subscription to the moderation list at
+// listUri. It is not an error if there is none.
+func (atpClient *ATPClient) UnsubscribeModListContext(ctx context.Context, listUri string) error {
+	var subscriptions []*ListBlockRecord
+	for record, err := range atpClient.ListListBlockRecordsIter(ctx, nil) {
+		if err != nil {
+			return fmt.Errorf("error unsubscribing from list %s: %w", listUri, err)
+		}
+
+		if record.List == listUri {
+			subscriptions = append(subscriptions, record)
+		}
+	}
+
+	for _, subscription := range subscriptions {
+		err := atpClient.invoke(ctx, func(ctx context.Context) error {
+			return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+				Collection: GraphListBlockLexicon,
+				Repo:       atpClient.Client.Auth.Did,
+				Rkey:       subscription.RecordKey,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("error unsubscribing from list %s: %w", listUri, err)
+		}
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) ListListBlockRecordsIter(ctx context.Context, opts *PageOptions) iter.Seq2[*ListBlockRecord, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*ListBlockRecord, *string, error) {
+			var resp *atproto.RepoListRecords_Output
+			err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+				resp, err = atproto.RepoListRecords(
+					ctx, atpClient.Client, GraphListBlockLexicon, cursor, limit,
+					atpClient.Client.Auth.Did, false, "", "")
+				return err
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("error listing list block records: %w", err)
+			}
+
+			records := make([]*ListBlockRecord, 0, len(resp.Records))
+			for _, record := range resp.Records {
+				listBlock, ok := record.Value.Val.(*bsky.GraphListblock)
+				if !ok {
+					continue
+				}
+
+				records = append(records, &ListBlockRecord{
+					List:      listBlock.Subject,
+					Uri:       record.Uri,
+					RecordKey: util.GetRecordKeyFromUrlOrAtUri(record.Uri),
+				})
+			}
+
+			return records, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) GetListBlocks(cursor string, limit int64) (*bsky.GraphGetListBlocks_Output, error) {
+	return atpClient.GetListBlocksContext(context.Background(), cursor, limit)
+}
+
+// GetListBlocksContext returns the moderation lists the account subscribed to as
+// block lists.
+func (atpClient *ATPClient) GetListBlocksContext(
+	ctx context.Context, cursor string, limit int64) (*bsky.GraphGetListBlocks_Output, error) {
+	var resp *bsky.GraphGetListBlocks_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.GraphGetListBlocks(ctx, atpClient.Client, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting list blocks: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) GetListBlocksIter(ctx context.Context, opts *PageOptions) iter.Seq2[*bsky.GraphDefs_ListView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.GraphDefs_ListView, *string, error) {
+			resp, err := atpClient.GetListBlocksContext(ctx, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Lists, resp.Cursor, nil
+		})
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"iter"
+)
+
+func (atpClient *ATPClient) UnmuteDid(did string) error {
+	return atpClient.UnmuteDidContext(context.Background(), did)
+}
+
+func (atpClient *ATPClient) UnmuteDidContext(ctx context.Context, did string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return bsky.GraphUnmuteActor(ctx, atpClient.Client, &bsky.GraphUnmuteActor_Input{Actor: did})
+	})
+	if err != nil {
+		return fmt.Errorf("error unmuting DID %s: %w", did, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) UnmuteHandle(handle string) error {
+	return atpClient.UnmuteHandleContext(context.Background(), handle)
+}
+
+func (atpClient *ATPClient) UnmuteHandleContext(ctx context.Context, handle string) error {
+	did, err := atpClient.ResolveHandleContext(ctx, handle)
+	if err != nil {
+		return fmt.Errorf("error unmuting handle %s: %w", handle, err)
+	}
+
+	return atpClient.UnmuteDidContext(ctx, did)
+}
+
+func (atpClient *ATPClient) GetMutes(cursor string, limit int64) (*bsky.GraphGetMutes_Output, error) {
+	return atpClient.GetMutesContext(context.Background(), cursor, limit)
+}
+
+func (atpClient *ATPClient) GetMutesContext(ctx context.Context, cursor string, limit int64) (*bsky.GraphGetMutes_Output, error) {
+	var resp *bsky.GraphGetMutes_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.GraphGetMutes(ctx, atpClient.Client, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting mutes: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) GetMutesIter(ctx context.Context, opts *PageOptions) iter.Seq2[*bsky.ActorDefs_ProfileView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.ActorDefs_ProfileView, *string, error) {
+			resp, err := atpClient.GetMutesContext(ctx, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Mutes, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) MuteList(listUri string) error {
+	return atpClient.MuteListContext(context.Background(), listUri)
+}
+
+// MuteListContext mutes every account of the moderation list at listUri.
+func (atpClient *ATPClient) MuteListContext(ctx context.Context, listUri string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return bsky.GraphMuteActorList(ctx, atpClient.Client, &bsky.GraphMuteActorList_Input{List: listUri})
+	})
+	if err != nil {
+		return fmt.Errorf("error muting list %s: %w", listUri, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) UnmuteList(listUri string) error {
+	return atpClient.UnmuteListContext(context.Background(), listUri)
+}
+
+func (atpClient *ATPClient) UnmuteListContext(ctx context.Context, listUri string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return bsky.GraphUnmuteActorList(ctx, atpClient.Client, &bsky.GraphUnmuteActorList_Input{List: listUri})
+	})
+	if err != nil {
+		return fmt.Errorf("error unmuting list %s: %w", listUri, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) GetListMutes(cursor string, limit int64) (*bsky.GraphGetListMutes_Output, error) {
+	return atpClient.GetListMutesContext(context.Background(), cursor, limit)
+}
+
+func (atpClient *ATPClient) GetListMutesContext(
+	ctx context.Context, cursor string, limit int64) (*bsky.GraphGetListMutes_Output, error) {
+	var resp *bsky.GraphGetListMutes_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.GraphGetListMutes(ctx, atpClient.Client, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting muted lists: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) GetListMutesIter(ctx context.Context, opts *PageOptions) iter.Seq2[*bsky.GraphDefs_ListView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.GraphDefs_ListView, *string, error) {
+			resp, err := atpClient.GetListMutesContext(ctx, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Lists, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) MuteThread(rootUri string) error {
+	return atpClient.MuteThreadContext(context.Background(), rootUri)
+}
+
+// MuteThreadContext mutes notifications from the thread of the root post at rootUri.
+func (atpClient *ATPClient) MuteThreadContext(ctx context.Context, rootUri string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return bsky.GraphMuteThread(ctx, atpClient.Client, &bsky.GraphMuteThread_Input{Root: rootUri})
+	})
+	if err != nil {
+		return fmt.Errorf("error muting thread %s: %w", rootUri, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) UnmuteThread(rootUri string) error {
+	return atpClient.UnmuteThreadContext(context.Background(), rootUri)
+}
+
+func (atpClient *ATPClient) UnmuteThreadContext(ctx context.Context, rootUri string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return bsky.GraphUnmuteThread(ctx, atpClient.Client, &bsky.GraphUnmuteThread_Input{Root: rootUri})
+	})
+	if err != nil {
+		return fmt.Errorf("error unmuting thread %s: %w", rootUri, err)
+	}
+
+	return nil
+}
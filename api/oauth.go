@@ -0,0 +1,303 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/suvpen/suvatp/atperr"
+	"github.com/suvpen/suvatp/identity"
+	"github.com/suvpen/suvatp/oauth"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauthState holds the OAuth session of a client signed in through OAuth. It is
+// shared with the client's transport, which turns the bearer tokens set by xrpc
+// into DPoP-bound requests.
+type oauthState struct {
+	mu          sync.RWMutex
+	session     *oauth.Session
+	client      *oauth.Client
+	accessToken string
+}
+
+func (state *oauthState) get() (*oauth.Session, *oauth.Client, string) {
+	if state == nil {
+		return nil, nil, ""
+	}
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	return state.session, state.client, state.accessToken
+}
+
+func (state *oauthState) set(session *oauth.Session, client *oauth.Client, accessToken string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.session = session
+	state.client = client
+	state.accessToken = accessToken
+}
+
+// IsOAuth reports whether atpClient was signed in through OAuth rather than with an
+// app password.
+func (atpClient *ATPClient) IsOAuth() bool {
+	session, _, _ := atpClient.oauth.get()
+	return session != nil
+}
+
+type dpopTransport struct {
+	base  http.RoundTripper
+	state *oauthState
+}
+
+func (transport *dpopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	session, client, accessToken := transport.state.get()
+
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if session == nil || !ok || token != accessToken {
+		return transport.base.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		proof, err := session.DPoPKey.Proof(req.Method, req.URL.String(), client.Nonce(req.URL.String()), token)
+		if err != nil {
+			return nil, err
+		}
+
+		dpopReq := req.Clone(req.Context())
+		if attempt > 0 && req.GetBody != nil {
+			if dpopReq.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		dpopReq.Header.Set("Authorization", "DPoP "+token)
+		dpopReq.Header.Set("DPoP", proof)
+
+		resp, err := transport.base.RoundTrip(dpopReq)
+		if err != nil {
+			return nil, err
+		}
+
+		client.SetNonce(req.URL.String(), resp.Header.Get("DPoP-Nonce"))
+
+		retry := resp.StatusCode == http.StatusUnauthorized &&
+			strings.Contains(resp.Header.Get("WWW-Authenticate"), "use_dpop_nonce") &&
+			attempt == 0 && (req.Body == nil || req.GetBody != nil)
+		if !retry {
+			return resp, nil
+		}
+
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// tokenExpired also recognises the invalid_token answer OAuth resource servers give
+// for expired access tokens.
+func (atpClient *ATPClient) tokenExpired(err error) bool {
+	if atperr.IsTokenExpiredError(err) {
+		return true
+	}
+
+	if !atpClient.IsOAuth() {
+		return false
+	}
+
+	atpErr, ok := atperr.AsATPError(err)
+	return ok && atpErr.StatusCode == http.StatusUnauthorized &&
+		(atpErr.Name == "InvalidToken" || atpErr.Name == "invalid_token")
+}
+
+// sessionExpired reports whether the access token expires within the next minute.
+func (atpClient *ATPClient) sessionExpired() (bool, error) {
+	if session, _, _ := atpClient.oauth.get(); session != nil {
+		return time.Now().Add(time.Minute).After(session.ExpiresAt), nil
+	}
+
+	return getJWTExpiration(atpClient)
+}
+
+// refreshOAuth renews DPoP-bound tokens; the caller holds atpClient.mu.
+func (atpClient *ATPClient) refreshOAuth(ctx context.Context) error {
+	session, client, _ := atpClient.oauth.get()
+
+	tokens, err := client.Refresh(ctx, session.TokenEndpoint, atpClient.Client.Auth.RefreshJwt, session.DPoPKey)
+	if err != nil {
+		return fmt.Errorf("error refreshing session of %s: %w", atpClient.Did, err)
+	}
+
+	refreshed := *session
+	refreshed.ExpiresAt = tokens.ExpiresAt
+	if tokens.Scope != "" {
+		refreshed.Scope = tokens.Scope
+	}
+
+	atpClient.oauth.set(&refreshed, client, tokens.AccessToken)
+	atpClient.setAuth(tokens.AccessToken, tokens.RefreshToken, atpClient.Client.Auth.Handle, atpClient.Client.Auth.Did)
+
+	return atpClient.saveSession()
+}
+
+// revokeOAuth revokes the refresh token, which ends the whole OAuth session.
+func (atpClient *ATPClient) revokeOAuth(ctx context.Context) error {
+	session, client, _ := atpClient.oauth.get()
+	if session.RevocationEndpoint == "" {
+		return nil
+	}
+
+	return client.Revoke(ctx, session.RevocationEndpoint, atpClient.Client.Auth.RefreshJwt, session.DPoPKey)
+}
+
+// OAuthLogin is an authorization in progress. Send the user to AuthorizationURL and
+// pass the parameters of the redirect to Complete.
+type OAuthLogin struct {
+	AuthorizationURL string
+
+	did     string
+	request *oauth.AuthRequest
+	client  *oauth.Client
+	config  *Config
+	options *clientOptions
+}
+
+// StartOAuthLogin begins signing in through the authorization server of the
+// account's PDS. identifier is a handle or DID; when empty, the user picks the
+// account at the authorization server of config.ATProtoEndpoint.
+func StartOAuthLogin(
+	ctx context.Context, identifier string, oauthConfig *oauth.Config, config *Config,
+	opts ...ClientOption) (*OAuthLogin, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	options := newClientOptions(config, opts)
+	login := &OAuthLogin{
+		client:  oauth.NewClient(oauthConfig, options.httpClient),
+		config:  config,
+		options: options,
+	}
+
+	pdsEndpoint := config.ATProtoEndpoint
+	if identifier != "" {
+		login.did = identifier
+		if !identity.IsDid(identifier) {
+			did, err := options.resolver.ResolveHandle(ctx, identifier)
+			if err != nil {
+				return nil, err
+			}
+
+			login.did = did
+		}
+
+		doc, err := options.resolver.ResolveDid(ctx, login.did)
+		if err != nil {
+			return nil, err
+		}
+
+		if pdsEndpoint = doc.PDSEndpoint(); pdsEndpoint == "" {
+			return nil, fmt.Errorf("error signing in %s: DID document has no %s service",
+				identifier, identity.AtprotoPdsServiceId)
+		}
+	}
+
+	server, err := login.client.AuthServerForPDS(ctx, pdsEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	login.request, err = login.client.StartAuthorization(ctx, server, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	login.AuthorizationURL = login.request.AuthorizationURL
+
+	return login, nil
+}
+
+// Complete redeems the authorization code and returns a client for the account. The
+// session is saved to the session store, so the client can later be resumed with
+// Client(did, "", config) and the same options.
+func (login *OAuthLogin) Complete(ctx context.Context, code, state, iss string) (*ATPClient, error) {
+	tokens, err := login.client.Exchange(ctx, login.request, code, state, iss)
+	if err != nil {
+		return nil, err
+	}
+
+	if login.did != "" && tokens.Sub != login.did {
+		return nil, fmt.Errorf("error signing in %s: authorized account is %s", login.did, tokens.Sub)
+	}
+
+	doc, err := login.options.resolver.ResolveDid(ctx, tokens.Sub)
+	if err != nil {
+		return nil, err
+	}
+
+	pdsEndpoint := doc.PDSEndpoint()
+	if pdsEndpoint == "" {
+		return nil, fmt.Errorf("error signing in %s: DID document has no %s service",
+			tokens.Sub, identity.AtprotoPdsServiceId)
+	}
+
+	// the account must be served by the authorization server that issued the tokens
+	server, err := login.client.AuthServerForPDS(ctx, pdsEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	if server.Issuer != login.request.Server.Issuer {
+		return nil, fmt.Errorf("%w: %s is served by %s", oauth.ErrIssuerMismatch, tokens.Sub, server.Issuer)
+	}
+
+	atpClient := &ATPClient{
+		Config: login.config,
+		Did:    tokens.Sub,
+	}
+	login.options.apply(atpClient)
+
+	atpClient.oauth.set(oauth.NewSession(login.client, login.request, tokens), login.client, tokens.AccessToken)
+
+	// OAuth tokens are issued for the PDS itself, not the entryway
+	atpClient.Client = atpClient.attach(&xrpc.Client{Host: pdsEndpoint})
+
+	err = atpClient.startSession(ctx, tokens.AccessToken, tokens.RefreshToken, doc.Handle(), tokens.Sub, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return atpClient, nil
+}
+
+// LoginWithLocalCallback signs in a CLI user: it listens for the redirect on a
+// loopback port, registers as a loopback client, has open show the authorization
+// URL (e.g. by launching a browser) and waits for the user to come back.
+func LoginWithLocalCallback(
+	ctx context.Context, identifier, scope string, open func(authorizationURL string) error, config *Config,
+	opts ...ClientOption) (*ATPClient, error) {
+	callback, err := oauth.NewLocalCallback("127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer callback.Close()
+
+	login, err := StartOAuthLogin(ctx, identifier, oauth.LoopbackConfig(callback.RedirectURI, scope), config, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = open(login.AuthorizationURL); err != nil {
+		return nil, err
+	}
+
+	result, err := callback.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return login.Complete(ctx, result.Code, result.State, result.Iss)
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/suvpen/suvatp/identity"
+	"github.com/suvpen/suvatp/oauth"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testOAuthDid         = "did:plc:oauthaccount"
+	testOAuthOtherDid    = "did:plc:otheraccount"
+	testOAuthRedirectURI = "http://127.0.0.1:8080/callback"
+)
+
+// testOAuthServer stands in for a PLC directory, a PDS and its authorization server
+// at once. The tokens it issues are for sub; DID documents point each account at
+// the PDS listed in pds.
+type testOAuthServer struct {
+	*httptest.Server
+
+	mu  sync.Mutex
+	sub string
+	pds map[string]string
+}
+
+func newTestOAuthServer(t *testing.T) *testOAuthServer {
+	t.Helper()
+
+	server := &testOAuthServer{sub: testOAuthDid, pds: make(map[string]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", server.didDoc)
+	mux.HandleFunc("/.well-known/oauth-protected-resource", server.protectedResource)
+	mux.HandleFunc("/.well-known/oauth-authorization-server", server.metadata)
+	mux.HandleFunc("/oauth/par", server.pushedAuthorizationRequest)
+	mux.HandleFunc("/oauth/token", server.token)
+
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	server.servesAccount(testOAuthDid, server.URL)
+
+	return server
+}
+
+func (server *testOAuthServer) servesAccount(did, pdsEndpoint string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.pds[did] = pdsEndpoint
+}
+
+func (server *testOAuthServer) issueFor(sub string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.sub = sub
+}
+
+func (server *testOAuthServer) didDoc(w http.ResponseWriter, r *http.Request) {
+	did := strings.TrimPrefix(r.URL.Path, "/")
+
+	server.mu.Lock()
+	pdsEndpoint, ok := server.pds[did]
+	server.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &identity.DidDoc{
+		Context:     []string{"https://www.w3.org/ns/did/v1"},
+		Id:          did,
+		AlsoKnownAs: []string{"at://" + strings.TrimPrefix(did, "did:plc:") + ".example.com"},
+		Service: []identity.Service{{
+			Id:              identity.AtprotoPdsServiceId,
+			Type:            identity.AtprotoPdsServiceType,
+			ServiceEndpoint: pdsEndpoint,
+		}},
+	})
+}
+
+func (server *testOAuthServer) protectedResource(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"resource":              server.URL,
+		"authorization_servers": []string{server.URL},
+	})
+}
+
+func (server *testOAuthServer) metadata(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &oauth.AuthServerMetadata{
+		Issuer:                             server.URL,
+		AuthorizationEndpoint:              server.URL + "/oauth/authorize",
+		TokenEndpoint:                      server.URL + "/oauth/token",
+		PushedAuthorizationRequestEndpoint: server.URL + "/oauth/par",
+		AuthorizationResponseIssParameterSupported: true,
+	})
+}
+
+func (server *testOAuthServer) pushedAuthorizationRequest(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"request_uri": "urn:ietf:params:oauth:request_uri:req-1",
+		"expires_in":  60,
+	})
+}
+
+func (server *testOAuthServer) token(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	sub := server.sub
+	server.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token":  "access-1",
+		"token_type":    "DPoP",
+		"refresh_token": "refresh-1",
+		"scope":         oauth.DefaultScope,
+		"sub":           sub,
+		"expires_in":    3600,
+	})
+}
+
+func startTestOAuthLogin(t *testing.T, server *testOAuthServer, identifier string) *OAuthLogin {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.ATProtoEndpoint = server.URL
+	config.PLCDirectoryURL = server.URL
+
+	login, err := StartOAuthLogin(context.Background(), identifier,
+		oauth.LoopbackConfig(testOAuthRedirectURI, ""), config, WithSessionStore(NewMemorySessionStore()))
+	if err != nil {
+		t.Fatalf("starting login: %v", err)
+	}
+
+	return login
+}
+
+func TestOAuthLoginComplete(t *testing.T) {
+	server := newTestOAuthServer(t)
+	login := startTestOAuthLogin(t, server, testOAuthDid)
+
+	if !strings.HasPrefix(login.AuthorizationURL, server.URL+"/oauth/authorize?") {
+		t.Errorf("authorization URL = %s", login.AuthorizationURL)
+	}
+
+	atpClient, err := login.Complete(context.Background(), "code-1", login.request.State, server.URL)
+	if err != nil {
+		t.Fatalf("completing login: %v", err)
+	}
+
+	if !atpClient.IsOAuth() {
+		t.Error("client is not signed in through OAuth")
+	}
+	if atpClient.Did != testOAuthDid {
+		t.Errorf("did = %s, want %s", atpClient.Did, testOAuthDid)
+	}
+	if atpClient.Client.Host != server.URL || atpClient.PdsClient.Host != server.URL {
+		t.Errorf("hosts = %s/%s, want the PDS %s", atpClient.Client.Host, atpClient.PdsClient.Host, server.URL)
+	}
+	if got := atpClient.Client.Auth.Handle; got != "oauthaccount.example.com" {
+		t.Errorf("handle = %s", got)
+	}
+}
+
+func TestOAuthLoginCompleteRejectsOtherAccount(t *testing.T) {
+	server := newTestOAuthServer(t)
+	server.servesAccount(testOAuthOtherDid, server.URL)
+	server.issueFor(testOAuthOtherDid)
+
+	login := startTestOAuthLogin(t, server, testOAuthDid)
+
+	_, err := login.Complete(context.Background(), "code-1", login.request.State, server.URL)
+	if err == nil || !strings.Contains(err.Error(), "authorized account is "+testOAuthOtherDid) {
+		t.Fatalf("err = %v, want the other account to be refused", err)
+	}
+}
+
+func TestOAuthLoginCompleteRejectsAccountOfOtherIssuer(t *testing.T) {
+	server := newTestOAuthServer(t)
+	otherServer := newTestOAuthServer(t)
+
+	// the account is hosted by a PDS whose authorization server did not issue the tokens
+	server.servesAccount(testOAuthOtherDid, otherServer.URL)
+	server.issueFor(testOAuthOtherDid)
+
+	login := startTestOAuthLogin(t, server, "")
+
+	_, err := login.Complete(context.Background(), "code-1", login.request.State, server.URL)
+	if !errors.Is(err, oauth.ErrIssuerMismatch) {
+		t.Fatalf("err = %v, want %v", err, oauth.ErrIssuerMismatch)
+	}
+}
+
+func TestOAuthLoginCompleteChecksResponseParameters(t *testing.T) {
+	server := newTestOAuthServer(t)
+	login := startTestOAuthLogin(t, server, testOAuthDid)
+
+	_, err := login.Complete(context.Background(), "code-1", "forged", server.URL)
+	if !errors.Is(err, oauth.ErrStateMismatch) {
+		t.Errorf("forged state: err = %v, want %v", err, oauth.ErrStateMismatch)
+	}
+
+	_, err = login.Complete(context.Background(), "code-1", login.request.State, "")
+	if !errors.Is(err, oauth.ErrIssuerMismatch) {
+		t.Errorf("missing iss: err = %v, want %v", err, oauth.ErrIssuerMismatch)
+	}
+}
@@ -6,61 +6,55 @@ import (
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/api/ozone"
 	"github.com/bluesky-social/indigo/xrpc"
-	"github.com/suvpen/suvatp/atperr"
-	"time"
 )
 
 func (atpClient *ATPClient) SearchRepos(q, cursor string, limit int64) (*ozone.ModerationSearchRepos_Output, error) {
-	resp, err := ozone.ModerationSearchRepos(context.TODO(), atpClient.LabelerClient, cursor, limit, q, "")
+	return atpClient.SearchReposContext(context.Background(), q, cursor, limit)
+}
+
+func (atpClient *ATPClient) SearchReposContext(ctx context.Context, q, cursor string, limit int64) (*ozone.ModerationSearchRepos_Output, error) {
+	var resp *ozone.ModerationSearchRepos_Output
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) (err error) {
+		resp, err = ozone.ModerationSearchRepos(ctx, atpClient.LabelerClient, cursor, limit, q, "")
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.SearchRepos(q, cursor, limit)
-			} else {
-				return nil, fmt.Errorf("error while searching repos of %s: %w", q, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error while searching repos of %s: %w", q, err)
-		}
+		return nil, fmt.Errorf("error while searching repos of %s: %w", q, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) QueryLabel(cursor string, limit int64) (*ozone.ModerationQueryEvents_Output, error) {
-	resp, err := ozone.ModerationQueryEvents(
-		context.TODO(), atpClient.LabelerClient,
-		nil, nil, "", "", "",
-		"", cursor, false, false, limit,
-		nil, nil, nil, "", "",
-		[]string{"tools.ozone.moderation.defs#modEventLabel"})
+	return atpClient.QueryLabelContext(context.Background(), cursor, limit)
+}
+
+func (atpClient *ATPClient) QueryLabelContext(ctx context.Context, cursor string, limit int64) (*ozone.ModerationQueryEvents_Output, error) {
+	var resp *ozone.ModerationQueryEvents_Output
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) (err error) {
+		resp, err = ozone.ModerationQueryEvents(
+			ctx, atpClient.LabelerClient,
+			nil, nil, "", "", "",
+			"", cursor, false, false, limit,
+			nil, nil, nil, "", "",
+			[]string{"tools.ozone.moderation.defs#modEventLabel"})
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.QueryLabel(cursor, limit)
-			} else {
-				return nil, fmt.Errorf("error querying label events: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error querying label events: %w", err)
-		}
+		return nil, fmt.Errorf("error querying label events: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) QueryOpenReports(cursor string, limit int64) (*ozone.ModerationQueryStatuses_Output, error) {
+	return atpClient.QueryOpenReportsContext(context.Background(), cursor, limit)
+}
+
+func (atpClient *ATPClient) QueryOpenReportsContext(ctx context.Context, cursor string, limit int64) (*ozone.ModerationQueryStatuses_Output, error) {
 	//TODO: uncomment if fixed
 	//resp, err := ozone.ModerationQueryStatuses(
-	//	context.TODO(), atpClient.LabelerClient,
+	//	ctx, atpClient.LabelerClient,
 	//	false, "", cursor, nil, nil,
 	//	true, "", limit, false, "", "",
 	//	"tools.ozone.moderation.defs#reviewOpen", "", "", "desc", "lastReportedAt",
@@ -70,7 +64,7 @@ func (atpClient *ATPClient) QueryOpenReports(cursor string, limit int64) (*ozone
 	//		if atpClient.RetryCount != atpClient.Config.Retries {
 	//			atpClient.RetryCount++
 	//			time.Sleep(time.Second * 3)
-	//			return atpClient.QueryOpenReports(cursor, limit)
+	//			return atpClient.QueryOpenReportsContext(ctx, cursor, limit)
 	//		} else {
 	//			return nil, fmt.Errorf("error querying open reports: %w", err)
 	//		}
@@ -91,54 +85,44 @@ func (atpClient *ATPClient) QueryOpenReports(cursor string, limit int64) (*ozone
 
 	var resp *ozone.ModerationQueryStatuses_Output
 
-	err := atpClient.LabelerClient.Do(
-		context.TODO(), xrpc.Query, "", "tools.ozone.moderation.queryStatuses", params, nil, &resp)
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) error {
+		return atpClient.LabelerClient.Do(
+			ctx, xrpc.Query, "", "tools.ozone.moderation.queryStatuses", params, nil, &resp)
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.QueryOpenReports(cursor, limit)
-			} else {
-				return nil, fmt.Errorf("error querying open reports: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error querying open reports: %w", err)
-		}
+		return nil, fmt.Errorf("error querying open reports: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) QueryEventDetail(subject string) (*ozone.ModerationQueryEvents_Output, error) {
-	resp, err := ozone.ModerationQueryEvents(
-		context.TODO(), atpClient.LabelerClient,
-		nil, nil, "", "", "",
-		"", "", false, false, 2,
-		nil, nil, nil, "", subject,
-		nil)
+	return atpClient.QueryEventDetailContext(context.Background(), subject)
+}
+
+func (atpClient *ATPClient) QueryEventDetailContext(ctx context.Context, subject string) (*ozone.ModerationQueryEvents_Output, error) {
+	var resp *ozone.ModerationQueryEvents_Output
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) (err error) {
+		resp, err = ozone.ModerationQueryEvents(
+			ctx, atpClient.LabelerClient,
+			nil, nil, "", "", "",
+			"", "", false, false, 2,
+			nil, nil, nil, "", subject,
+			nil)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.QueryEventDetail(subject)
-			} else {
-				return nil, fmt.Errorf("error querying label events: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error querying label events: %w", err)
-		}
+		return nil, fmt.Errorf("error querying label events: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) LabelAccount(adminDid, targetDid, label string) (*ozone.ModerationDefs_ModEventView, error) {
+	return atpClient.LabelAccountContext(context.Background(), adminDid, targetDid, label)
+}
+
+func (atpClient *ATPClient) LabelAccountContext(ctx context.Context, adminDid, targetDid, label string) (*ozone.ModerationDefs_ModEventView, error) {
 	eventInput := &ozone.ModerationEmitEvent_Input{
 		CreatedBy: adminDid,
 		Event: &ozone.ModerationEmitEvent_Input_Event{
@@ -154,27 +138,23 @@ func (atpClient *ATPClient) LabelAccount(adminDid, targetDid, label string) (*oz
 		},
 	}
 
-	resp, err := ozone.ModerationEmitEvent(context.TODO(), atpClient.LabelerClient, eventInput)
+	var resp *ozone.ModerationDefs_ModEventView
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) (err error) {
+		resp, err = ozone.ModerationEmitEvent(ctx, atpClient.LabelerClient, eventInput)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.LabelAccount(adminDid, targetDid, label)
-			} else {
-				return nil, fmt.Errorf("error labeling %s: %w", targetDid, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error labeling %s: %w", targetDid, err)
-		}
+		return nil, fmt.Errorf("error labeling %s: %w", targetDid, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) LabelPost(adminDid, cid, uri, label string) (*ozone.ModerationDefs_ModEventView, error) {
+	return atpClient.LabelPostContext(context.Background(), adminDid, cid, uri, label)
+}
+
+func (atpClient *ATPClient) LabelPostContext(ctx context.Context, adminDid, cid, uri, label string) (*ozone.ModerationDefs_ModEventView, error) {
 	eventInput := &ozone.ModerationEmitEvent_Input{
 		CreatedBy: adminDid,
 		Event: &ozone.ModerationEmitEvent_Input_Event{
@@ -191,27 +171,23 @@ func (atpClient *ATPClient) LabelPost(adminDid, cid, uri, label string) (*ozone.
 		},
 	}
 
-	resp, err := ozone.ModerationEmitEvent(context.TODO(), atpClient.LabelerClient, eventInput)
+	var resp *ozone.ModerationDefs_ModEventView
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) (err error) {
+		resp, err = ozone.ModerationEmitEvent(ctx, atpClient.LabelerClient, eventInput)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.LabelPost(adminDid, cid, uri, label)
-			} else {
-				return nil, fmt.Errorf("error labeling post %s: %w", uri, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error labeling post %s: %w", uri, err)
-		}
+		return nil, fmt.Errorf("error labeling post %s: %w", uri, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) NegateAccountLabel(adminDid, targetDid, label string) (*ozone.ModerationDefs_ModEventView, error) {
+	return atpClient.NegateAccountLabelContext(context.Background(), adminDid, targetDid, label)
+}
+
+func (atpClient *ATPClient) NegateAccountLabelContext(ctx context.Context, adminDid, targetDid, label string) (*ozone.ModerationDefs_ModEventView, error) {
 	eventInput := &ozone.ModerationEmitEvent_Input{
 		CreatedBy: adminDid,
 		Event: &ozone.ModerationEmitEvent_Input_Event{
@@ -227,27 +203,23 @@ func (atpClient *ATPClient) NegateAccountLabel(adminDid, targetDid, label string
 		},
 	}
 
-	resp, err := ozone.ModerationEmitEvent(context.TODO(), atpClient.LabelerClient, eventInput)
+	var resp *ozone.ModerationDefs_ModEventView
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) (err error) {
+		resp, err = ozone.ModerationEmitEvent(ctx, atpClient.LabelerClient, eventInput)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.NegateAccountLabel(adminDid, targetDid, label)
-			} else {
-				return nil, fmt.Errorf("error unlabeling %s: %w", targetDid, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error unlabeling %s: %w", targetDid, err)
-		}
+		return nil, fmt.Errorf("error unlabeling %s: %w", targetDid, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) NegatePostLabel(adminDid, cid, uri, label string) (*ozone.ModerationDefs_ModEventView, error) {
+	return atpClient.NegatePostLabelContext(context.Background(), adminDid, cid, uri, label)
+}
+
+func (atpClient *ATPClient) NegatePostLabelContext(ctx context.Context, adminDid, cid, uri, label string) (*ozone.ModerationDefs_ModEventView, error) {
 	eventInput := &ozone.ModerationEmitEvent_Input{
 		CreatedBy: adminDid,
 		Event: &ozone.ModerationEmitEvent_Input_Event{
@@ -264,27 +236,23 @@ func (atpClient *ATPClient) NegatePostLabel(adminDid, cid, uri, label string) (*
 		},
 	}
 
-	resp, err := ozone.ModerationEmitEvent(context.TODO(), atpClient.LabelerClient, eventInput)
+	var resp *ozone.ModerationDefs_ModEventView
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) (err error) {
+		resp, err = ozone.ModerationEmitEvent(ctx, atpClient.LabelerClient, eventInput)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.NegatePostLabel(adminDid, cid, uri, label)
-			} else {
-				return nil, fmt.Errorf("error unlabeling post %s: %w", uri, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error unlabeling post %s: %w", uri, err)
-		}
+		return nil, fmt.Errorf("error unlabeling post %s: %w", uri, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) AcknowledgeAccountRecord(adminDid, targetDid string) (*ozone.ModerationDefs_ModEventView, error) {
+	return atpClient.AcknowledgeAccountRecordContext(context.Background(), adminDid, targetDid)
+}
+
+func (atpClient *ATPClient) AcknowledgeAccountRecordContext(ctx context.Context, adminDid, targetDid string) (*ozone.ModerationDefs_ModEventView, error) {
 	eventInput := &ozone.ModerationEmitEvent_Input{
 		CreatedBy: adminDid,
 		Event: &ozone.ModerationEmitEvent_Input_Event{
@@ -297,27 +265,23 @@ func (atpClient *ATPClient) AcknowledgeAccountRecord(adminDid, targetDid string)
 		},
 	}
 
-	resp, err := ozone.ModerationEmitEvent(context.TODO(), atpClient.LabelerClient, eventInput)
+	var resp *ozone.ModerationDefs_ModEventView
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) (err error) {
+		resp, err = ozone.ModerationEmitEvent(ctx, atpClient.LabelerClient, eventInput)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.AcknowledgeAccountRecord(adminDid, targetDid)
-			} else {
-				return nil, fmt.Errorf("error acknowledging %s account record: %w", targetDid, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error acknowledging %s account record: %w", targetDid, err)
-		}
+		return nil, fmt.Errorf("error acknowledging %s account record: %w", targetDid, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) AcknowledgePostRecord(adminDid, cid, uri string) (*ozone.ModerationDefs_ModEventView, error) {
+	return atpClient.AcknowledgePostRecordContext(context.Background(), adminDid, cid, uri)
+}
+
+func (atpClient *ATPClient) AcknowledgePostRecordContext(ctx context.Context, adminDid, cid, uri string) (*ozone.ModerationDefs_ModEventView, error) {
 	eventInput := &ozone.ModerationEmitEvent_Input{
 		CreatedBy: adminDid,
 		Event: &ozone.ModerationEmitEvent_Input_Event{
@@ -331,22 +295,14 @@ func (atpClient *ATPClient) AcknowledgePostRecord(adminDid, cid, uri string) (*o
 		},
 	}
 
-	resp, err := ozone.ModerationEmitEvent(context.TODO(), atpClient.LabelerClient, eventInput)
+	var resp *ozone.ModerationDefs_ModEventView
+	err := atpClient.invokeLabeler(ctx, func(ctx context.Context) (err error) {
+		resp, err = ozone.ModerationEmitEvent(ctx, atpClient.LabelerClient, eventInput)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.AcknowledgePostRecord(adminDid, cid, uri)
-			} else {
-				return nil, fmt.Errorf("error acknowledging %s post record: %w", uri, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error acknowledging %s post record: %w", uri, err)
-		}
+		return nil, fmt.Errorf("error acknowledging %s post record: %w", uri, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
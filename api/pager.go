@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/api/chat"
+	"github.com/bluesky-social/indigo/api/ozone"
+	"iter"
+	"time"
+)
+
+const DefaultPageSize = 100
+
+// PageOptions bounds an iterator. MaxItems and MaxDuration end the iteration early
+// without an error; zero values mean no bound. PageSize is the limit sent with each
+// request, for the endpoints that accept one.
+type PageOptions struct {
+	MaxItems    int
+	MaxDuration time.Duration
+	PageSize    int64
+}
+
+func (opts *PageOptions) pageSize() int64 {
+	if opts == nil || opts.PageSize <= 0 {
+		return DefaultPageSize
+	}
+
+	return opts.PageSize
+}
+
+// paginate follows the cursors returned by fetch until the last page, a bound of opts
+// or the end of ctx. An error is yielded once, as the last element. MaxDuration also
+// bounds the fetch in flight when it runs out.
+func paginate[T any](
+	ctx context.Context, opts *PageOptions,
+	fetch func(ctx context.Context, cursor string, limit int64) ([]T, *string, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		var maxItems int
+
+		fetchCtx := ctx
+		if opts != nil {
+			maxItems = opts.MaxItems
+			if opts.MaxDuration > 0 {
+				var cancel context.CancelFunc
+				fetchCtx, cancel = context.WithDeadline(ctx, time.Now().Add(opts.MaxDuration))
+				defer cancel()
+			}
+		}
+
+		var cursor string
+		var count int
+
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			if fetchCtx.Err() != nil {
+				return
+			}
+
+			items, next, err := fetch(fetchCtx, cursor, opts.pageSize())
+			if err != nil {
+				// running out of MaxDuration ends the iteration without an error
+				if ctx.Err() == nil && fetchCtx.Err() != nil {
+					return
+				}
+
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+
+				count++
+				if maxItems > 0 && count >= maxItems {
+					return
+				}
+			}
+
+			// an unchanged cursor would repeat the same page forever; an empty page
+			// with a new cursor is not the end, as filtered pages can come back empty
+			if next == nil || *next == "" || *next == cursor {
+				return
+			}
+
+			cursor = *next
+		}
+	}
+}
+
+func (atpClient *ATPClient) GetAuthorFeedIter(
+	ctx context.Context, did, filter string, opts *PageOptions) iter.Seq2[*bsky.FeedDefs_FeedViewPost, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.FeedDefs_FeedViewPost, *string, error) {
+			resp, err := atpClient.GetAuthorFeedContext(ctx, did, cursor, filter, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Feed, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) GetFollowsIter(
+	ctx context.Context, opts *PageOptions) iter.Seq2[*bsky.ActorDefs_ProfileView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, _ int64) ([]*bsky.ActorDefs_ProfileView, *string, error) {
+			resp, err := atpClient.GetFollowsContext(ctx, cursor)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Follows, resp.Cursor, nil
+		})
+}
+
+// GetLikesIter looks the post up once and then pages through its likes.
+func (atpClient *ATPClient) GetLikesIter(
+	ctx context.Context, didOrHandle, rKey string, opts *PageOptions) iter.Seq2[*bsky.FeedGetLikes_Like, error] {
+	var uri, cid string
+
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.FeedGetLikes_Like, *string, error) {
+			if uri == "" {
+				postRecord, err := atpClient.GetPostContext(ctx, didOrHandle, rKey)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error getting likes: %w", err)
+				}
+				if postRecord.Cid == nil {
+					return nil, nil, fmt.Errorf("error getting likes: post %s has no CID", postRecord.Uri)
+				}
+
+				uri, cid = postRecord.Uri, *postRecord.Cid
+			}
+
+			var resp *bsky.FeedGetLikes_Output
+			err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+				resp, err = bsky.FeedGetLikes(ctx, atpClient.Client, cid, cursor, limit, uri)
+				return err
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("error getting %s likes: %w", uri, err)
+			}
+
+			return resp.Likes, resp.Cursor, nil
+		})
+}
+
+// GetRepostedByIter looks the post up once and then pages through its reposters.
+func (atpClient *ATPClient) GetRepostedByIter(
+	ctx context.Context, didOrHandle, rKey string, opts *PageOptions) iter.Seq2[*bsky.ActorDefs_ProfileView, error] {
+	var uri, cid string
+
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.ActorDefs_ProfileView, *string, error) {
+			if uri == "" {
+				postRecord, err := atpClient.GetPostContext(ctx, didOrHandle, rKey)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error getting repostedby: %w", err)
+				}
+				if postRecord.Cid == nil {
+					return nil, nil, fmt.Errorf("error getting repostedby: post %s has no CID", postRecord.Uri)
+				}
+
+				uri, cid = postRecord.Uri, *postRecord.Cid
+			}
+
+			var resp *bsky.FeedGetRepostedBy_Output
+			err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+				resp, err = bsky.FeedGetRepostedBy(ctx, atpClient.Client, cid, cursor, limit, uri)
+				return err
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("error getting repostedby: %w", err)
+			}
+
+			return resp.RepostedBy, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) SearchPostIter(
+	ctx context.Context, q string, opts *PageOptions) iter.Seq2[*bsky.FeedDefs_PostView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.FeedDefs_PostView, *string, error) {
+			resp, err := atpClient.SearchPostContext(ctx, q, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Posts, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) SearchActorsIter(
+	ctx context.Context, q string, opts *PageOptions) iter.Seq2[*bsky.ActorDefs_ProfileView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.ActorDefs_ProfileView, *string, error) {
+			resp, err := atpClient.SearchActorsContext(ctx, q, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Actors, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) ListConvosIter(
+	ctx context.Context, opts *PageOptions) iter.Seq2[*chat.ConvoDefs_ConvoView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*chat.ConvoDefs_ConvoView, *string, error) {
+			resp, err := atpClient.ListConvosContext(ctx, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Convos, resp.Cursor, nil
+		})
+}
+
+// GetLogIter pages through the chat log until it is caught up.
+func (atpClient *ATPClient) GetLogIter(
+	ctx context.Context, opts *PageOptions) iter.Seq2[*chat.ConvoGetLog_Output_Logs_Elem, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, _ int64) ([]*chat.ConvoGetLog_Output_Logs_Elem, *string, error) {
+			resp, err := atpClient.GetLogContext(ctx, cursor)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Logs, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) QueryLabelIter(
+	ctx context.Context, opts *PageOptions) iter.Seq2[*ozone.ModerationDefs_ModEventView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*ozone.ModerationDefs_ModEventView, *string, error) {
+			resp, err := atpClient.QueryLabelContext(ctx, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Events, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) QueryOpenReportsIter(
+	ctx context.Context, opts *PageOptions) iter.Seq2[*ozone.ModerationDefs_SubjectStatusView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*ozone.ModerationDefs_SubjectStatusView, *string, error) {
+			resp, err := atpClient.QueryOpenReportsContext(ctx, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.SubjectStatuses, resp.Cursor, nil
+		})
+}
+
+func (atpClient *ATPClient) SearchReposIter(
+	ctx context.Context, q string, opts *PageOptions) iter.Seq2[*ozone.ModerationDefs_RepoView, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*ozone.ModerationDefs_RepoView, *string, error) {
+			resp, err := atpClient.SearchReposContext(ctx, q, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.Repos, resp.Cursor, nil
+		})
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/suvpen/suvatp/identity"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrUnknownAccount = errors.New("account is not part of the pool")
+
+type Account struct {
+	Did         string `json:"did"`
+	Handle      string `json:"handle,omitempty"`
+	AppPassword string `json:"app_password"`
+}
+
+// CredentialSource supplies the accounts of an AccountPool.
+type CredentialSource interface {
+	Accounts(ctx context.Context) ([]Account, error)
+}
+
+// StaticCredentials is a fixed list of accounts.
+type StaticCredentials []Account
+
+func (credentials StaticCredentials) Accounts(_ context.Context) ([]Account, error) {
+	return credentials, nil
+}
+
+// FileCredentials reads a JSON array of accounts from Path.
+type FileCredentials struct {
+	Path string
+}
+
+func (credentials FileCredentials) Accounts(_ context.Context) ([]Account, error) {
+	data, err := os.ReadFile(credentials.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", credentials.Path, err)
+	}
+
+	var accounts []Account
+	if err = json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %s: %w", credentials.Path, err)
+	}
+
+	return accounts, nil
+}
+
+type poolEntry struct {
+	account Account
+
+	mu     sync.Mutex
+	client *ATPClient
+}
+
+// AccountPool manages the clients of many accounts. Sessions are only created or
+// resumed when an account is first used, and all clients share one HTTP transport
+// and identity resolver. It is safe for concurrent use.
+type AccountPool struct {
+	config   *Config
+	opts     []ClientOption
+	source   CredentialSource
+	resolver *identity.Resolver
+
+	mu      sync.RWMutex
+	entries map[string]*poolEntry
+	order   []string
+	handles map[string]string
+}
+
+// NewAccountPool loads the accounts of source. opts apply to every client; unless they
+// set their own, the clients share an HTTP client and resolver created by the pool.
+func NewAccountPool(
+	ctx context.Context, source CredentialSource, config *Config, opts ...ClientOption) (*AccountPool, error) {
+	var plcURL string
+	if config != nil {
+		plcURL = config.PLCDirectoryURL
+	}
+
+	httpClient := &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+
+	resolver := identity.NewResolver(plcURL)
+	resolver.HTTPClient.Transport = httpClient.Transport
+
+	pool := &AccountPool{
+		config:   config,
+		opts:     append([]ClientOption{WithHTTPClient(httpClient), WithResolver(resolver)}, opts...),
+		source:   source,
+		resolver: resolver,
+	}
+
+	if err := pool.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// Reload reads the accounts from the credential source again. Clients of accounts
+// whose app password did not change are kept.
+func (pool *AccountPool) Reload(ctx context.Context) error {
+	accounts, err := pool.source.Accounts(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading accounts: %w", err)
+	}
+
+	pool.mu.Lock()
+
+	entries := make(map[string]*poolEntry, len(accounts))
+	handles := make(map[string]string)
+	order := make([]string, 0, len(accounts))
+	reused := make(map[*poolEntry]string)
+
+	for _, account := range accounts {
+		if err = identity.ValidateDid(account.Did); err != nil {
+			pool.mu.Unlock()
+			return fmt.Errorf("error loading accounts: %w", err)
+		}
+
+		if _, ok := entries[account.Did]; ok {
+			pool.mu.Unlock()
+			return fmt.Errorf("error loading accounts: %s is listed twice", account.Did)
+		}
+
+		// only the handle of an entry changes, so its app password can be read
+		// without its lock
+		entry := &poolEntry{account: account}
+		if previous, ok := pool.entries[account.Did]; ok && previous.account.AppPassword == account.AppPassword {
+			entry = previous
+			reused[entry] = account.Handle
+		}
+
+		entries[account.Did] = entry
+		order = append(order, account.Did)
+
+		if account.Handle != "" {
+			handles[normalizeHandle(account.Handle)] = account.Did
+		}
+	}
+
+	for handle, did := range pool.handles {
+		if _, ok := entries[did]; ok {
+			if _, taken := handles[handle]; !taken {
+				handles[handle] = did
+			}
+		}
+	}
+
+	pool.entries = entries
+	pool.order = order
+	pool.handles = handles
+
+	pool.mu.Unlock()
+
+	// ClientContext takes pool.mu while holding an entry's lock, so entries are
+	// only locked once pool.mu is released
+	for entry, handle := range reused {
+		entry.mu.Lock()
+		entry.account.Handle = handle
+		entry.mu.Unlock()
+	}
+
+	return nil
+}
+
+func normalizeHandle(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(handle, "@"))
+}
+
+// Accounts returns the DIDs of the pool in the order of the credential source.
+func (pool *AccountPool) Accounts() []string {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return append([]string(nil), pool.order...)
+}
+
+func (pool *AccountPool) Client(didOrHandle string) (*ATPClient, error) {
+	return pool.ClientContext(context.Background(), didOrHandle)
+}
+
+// ClientContext returns the client of an account by DID or handle, signing in or
+// resuming its stored session on first use.
+func (pool *AccountPool) ClientContext(ctx context.Context, didOrHandle string) (*ATPClient, error) {
+	entry, err := pool.entry(ctx, didOrHandle)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.client != nil {
+		return entry.client, nil
+	}
+
+	atpClient, err := ClientContext(ctx, entry.account.Did, entry.account.AppPassword, pool.config, pool.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.client = atpClient
+
+	if atpClient.Client.Auth != nil && atpClient.Client.Auth.Handle != "" {
+		pool.mu.Lock()
+		pool.handles[normalizeHandle(atpClient.Client.Auth.Handle)] = entry.account.Did
+		pool.mu.Unlock()
+	}
+
+	return atpClient, nil
+}
+
+func (pool *AccountPool) entry(ctx context.Context, didOrHandle string) (*poolEntry, error) {
+	did := didOrHandle
+
+	if !identity.IsDid(didOrHandle) {
+		pool.mu.RLock()
+		known, ok := pool.handles[normalizeHandle(didOrHandle)]
+		pool.mu.RUnlock()
+
+		if ok {
+			did = known
+		} else {
+			resolved, err := pool.resolver.ResolveHandle(ctx, didOrHandle)
+			if err != nil {
+				return nil, err
+			}
+
+			did = resolved
+		}
+	}
+
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	entry, ok := pool.entries[did]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAccount, didOrHandle)
+	}
+
+	return entry, nil
+}
+
+type PoolResult[T any] struct {
+	Did   string
+	Value T
+	Err   error
+}
+
+// FanOut runs fn for every account of the pool, at most concurrency at a time
+// (unlimited when 0). Results are in account order; the returned error joins the
+// errors of all failed accounts.
+func FanOut[T any](
+	ctx context.Context, pool *AccountPool, concurrency int,
+	fn func(ctx context.Context, atpClient *ATPClient) (T, error)) ([]PoolResult[T], error) {
+	dids := pool.Accounts()
+	results := make([]PoolResult[T], len(dids))
+
+	if concurrency <= 0 {
+		concurrency = len(dids)
+	}
+	slots := make(chan struct{}, max(concurrency, 1))
+
+	var wg sync.WaitGroup
+	for i, did := range dids {
+		results[i].Did = did
+
+		wg.Add(1)
+		go func(result *PoolResult[T]) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				result.Err = ctx.Err()
+				return
+			}
+			defer func() { <-slots }()
+
+			atpClient, err := pool.ClientContext(ctx, result.Did)
+			if err != nil {
+				result.Err = err
+				return
+			}
+
+			result.Value, result.Err = fn(ctx, atpClient)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", result.Did, result.Err))
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
@@ -7,64 +7,59 @@ import (
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/api/bsky"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
-	"github.com/suvpen/suvatp/atperr"
 	"net/http"
 	"os"
 	"time"
 )
 
 func (atpClient *ATPClient) GetPost(didOrHandle, rKey string) (*atproto.RepoGetRecord_Output, error) {
-	resp, err := atproto.RepoGetRecord(
-		context.TODO(), atpClient.Client, "", atpClient.Config.PostsCollection, didOrHandle, rKey)
+	return atpClient.GetPostContext(context.Background(), didOrHandle, rKey)
+}
+
+func (atpClient *ATPClient) GetPostContext(ctx context.Context, didOrHandle, rKey string) (*atproto.RepoGetRecord_Output, error) {
+	var resp *atproto.RepoGetRecord_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoGetRecord(
+			ctx, atpClient.Client, "", atpClient.Config.PostsCollection, didOrHandle, rKey)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetPost(didOrHandle, rKey)
-			} else {
-				return nil, fmt.Errorf("error getting post record: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting post record: %w", err)
-		}
+		return nil, fmt.Errorf("error getting post record: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
-func (atpClient *ATPClient) GetPostThread(
-	didOrHandle, rKey string, depth, parentHeight int64) (*bsky.FeedGetPostThread_Output, error) {
+func (atpClient *ATPClient) GetPostThread(didOrHandle, rKey string, depth, parentHeight int64) (*bsky.FeedGetPostThread_Output, error) {
+	return atpClient.GetPostThreadContext(context.Background(), didOrHandle, rKey, depth, parentHeight)
+}
 
-	postRecord, err := atpClient.GetPost(didOrHandle, rKey)
+func (atpClient *ATPClient) GetPostThreadContext(
+	ctx context.Context, didOrHandle, rKey string, depth, parentHeight int64) (*bsky.FeedGetPostThread_Output, error) {
+
+	postRecord, err := atpClient.GetPostContext(ctx, didOrHandle, rKey)
 	if err != nil {
 		return nil, fmt.Errorf("error getting post thread: %w", err)
 	}
 
-	resp, err := bsky.FeedGetPostThread(
-		context.TODO(), atpClient.Client, depth, parentHeight, postRecord.Uri)
+	var resp *bsky.FeedGetPostThread_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.FeedGetPostThread(
+			ctx, atpClient.Client, depth, parentHeight, postRecord.Uri)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetPostThread(didOrHandle, rKey, depth, parentHeight)
-			} else {
-				return nil, fmt.Errorf("error getting post thread: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting post thread: %w", err)
-		}
+		return nil, fmt.Errorf("error getting post thread: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) GetAuthorFeed(did, cursor, filter string, limit int64) (*bsky.FeedGetAuthorFeed_Output, error) {
+	return atpClient.GetAuthorFeedContext(context.Background(), did, cursor, filter, limit)
+}
+
+func (atpClient *ATPClient) GetAuthorFeedContext(ctx context.Context, did, cursor, filter string, limit int64) (*bsky.FeedGetAuthorFeed_Output, error) {
 	filters := []string{FilterPostsWithReplies, FilterPostsNoReplies, FilterPostsWithMedia, FilterPostsAndAuthorThreads}
 	var found bool
 	for _, fil := range filters {
@@ -78,315 +73,265 @@ func (atpClient *ATPClient) GetAuthorFeed(did, cursor, filter string, limit int6
 		return nil, fmt.Errorf("error getting %s feed: invalid filter", did)
 	}
 
-	resp, err := bsky.FeedGetAuthorFeed(context.TODO(), atpClient.Client, did, cursor, filter, limit)
+	var resp *bsky.FeedGetAuthorFeed_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.FeedGetAuthorFeed(ctx, atpClient.Client, did, cursor, filter, limit)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetAuthorFeed(did, cursor, filter, limit)
-			} else {
-				return nil, fmt.Errorf("error getting %s feed: %w", did, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting %s feed: %w", did, err)
-		}
+		return nil, fmt.Errorf("error getting %s feed: %w", did, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) GetRepostedBy(didOrHandle, rKey, cursor string) (*bsky.FeedGetRepostedBy_Output, error) {
-	postRecord, err := atpClient.GetPost(didOrHandle, rKey)
+	return atpClient.GetRepostedByContext(context.Background(), didOrHandle, rKey, cursor)
+}
+
+func (atpClient *ATPClient) GetRepostedByContext(ctx context.Context, didOrHandle, rKey, cursor string) (*bsky.FeedGetRepostedBy_Output, error) {
+	postRecord, err := atpClient.GetPostContext(ctx, didOrHandle, rKey)
 	if err != nil {
 		return nil, fmt.Errorf("error getting repostedby: %w", err)
 	}
 
-	resp, err := bsky.FeedGetRepostedBy(
-		context.TODO(), atpClient.Client, *postRecord.Cid, cursor, 100, postRecord.Uri)
+	var resp *bsky.FeedGetRepostedBy_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.FeedGetRepostedBy(
+			ctx, atpClient.Client, *postRecord.Cid, cursor, 100, postRecord.Uri)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetRepostedBy(didOrHandle, rKey, cursor)
-			} else {
-				return nil, fmt.Errorf("error getting repostedby: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting repostedby: %w", err)
-		}
+		return nil, fmt.Errorf("error getting repostedby: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) GetLikes(didOrHandle, rKey, cursor string) (*bsky.FeedGetLikes_Output, error) {
-	postRecord, err := atpClient.GetPost(didOrHandle, rKey)
+	return atpClient.GetLikesContext(context.Background(), didOrHandle, rKey, cursor)
+}
+
+func (atpClient *ATPClient) GetLikesContext(ctx context.Context, didOrHandle, rKey, cursor string) (*bsky.FeedGetLikes_Output, error) {
+	postRecord, err := atpClient.GetPostContext(ctx, didOrHandle, rKey)
 	if err != nil {
 		return nil, fmt.Errorf("error getting likes: %w", err)
 	}
 
-	resp, err := bsky.FeedGetLikes(
-		context.TODO(), atpClient.Client, *postRecord.Cid, cursor, 100, postRecord.Uri)
+	var resp *bsky.FeedGetLikes_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.FeedGetLikes(
+			ctx, atpClient.Client, *postRecord.Cid, cursor, 100, postRecord.Uri)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetLikes(didOrHandle, rKey, cursor)
-			} else {
-				return nil, fmt.Errorf("error getting %s likes: %w", postRecord.Uri, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting %s likes: %w", postRecord.Uri, err)
-		}
+		return nil, fmt.Errorf("error getting %s likes: %w", postRecord.Uri, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) SearchPost(q, cursor string, limit int64) (*bsky.FeedSearchPosts_Output, error) {
-	resp, err := bsky.FeedSearchPosts(
-		context.TODO(), atpClient.Client, "", cursor, "", "",
-		limit, "", q, "", "",
-		nil, "", "")
+	return atpClient.SearchPostContext(context.Background(), q, cursor, limit)
+}
+
+func (atpClient *ATPClient) SearchPostContext(ctx context.Context, q, cursor string, limit int64) (*bsky.FeedSearchPosts_Output, error) {
+	var resp *bsky.FeedSearchPosts_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.FeedSearchPosts(
+			ctx, atpClient.Client, "", cursor, "", "",
+			limit, "", q, "", "",
+			nil, "", "")
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.SearchPost(q, cursor, limit)
-			} else {
-				return nil, fmt.Errorf("error searching post: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error searching post: %w", err)
-		}
+		return nil, fmt.Errorf("error searching post: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) Post(post *bsky.FeedPost) (*atproto.RepoCreateRecord_Output, error) {
-	resp, err := atproto.RepoCreateRecord(context.TODO(), atpClient.Client, &atproto.RepoCreateRecord_Input{
-		Collection: atpClient.Config.PostsCollection,
-		Repo:       atpClient.Client.Auth.Did,
-		Record: &lexutil.LexiconTypeDecoder{
-			Val: post,
-		},
+	return atpClient.PostContext(context.Background(), post)
+}
+
+func (atpClient *ATPClient) PostContext(ctx context.Context, post *bsky.FeedPost) (*atproto.RepoCreateRecord_Output, error) {
+	var resp *atproto.RepoCreateRecord_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: atpClient.Config.PostsCollection,
+			Repo:       atpClient.Client.Auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{
+				Val: post,
+			},
+		})
+		return err
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.Post(post)
-			} else {
-				return nil, fmt.Errorf("error creating post: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error creating post: %w", err)
-		}
+		return nil, fmt.Errorf("error creating post: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) ReplyPost(cid, uri string, post *bsky.FeedPost) (*atproto.RepoCreateRecord_Output, error) {
+	return atpClient.ReplyPostContext(context.Background(), cid, uri, post)
+}
+
+func (atpClient *ATPClient) ReplyPostContext(ctx context.Context, cid, uri string, post *bsky.FeedPost) (*atproto.RepoCreateRecord_Output, error) {
 	post.Reply = &bsky.FeedPost_ReplyRef{
 		Root:   &atproto.RepoStrongRef{Cid: cid, Uri: uri},
 		Parent: &atproto.RepoStrongRef{Cid: cid, Uri: uri},
 	}
 
-	resp, err := atproto.RepoCreateRecord(context.TODO(), atpClient.Client, &atproto.RepoCreateRecord_Input{
-		Collection: atpClient.Config.PostsCollection,
-		Repo:       atpClient.Client.Auth.Did,
-		Record: &lexutil.LexiconTypeDecoder{
-			Val: post,
-		},
+	var resp *atproto.RepoCreateRecord_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: atpClient.Config.PostsCollection,
+			Repo:       atpClient.Client.Auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{
+				Val: post,
+			},
+		})
+		return err
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.ReplyPost(cid, uri, post)
-			} else {
-				return nil, fmt.Errorf("error replying post: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error replying post: %w", err)
-		}
+		return nil, fmt.Errorf("error replying post: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) DeletePost(rKey string) error {
-	err := atproto.RepoDeleteRecord(context.TODO(), atpClient.Client, &atproto.RepoDeleteRecord_Input{
-		Collection: atpClient.Config.PostsCollection,
-		Repo:       atpClient.Client.Auth.Did,
-		Rkey:       rKey,
+	return atpClient.DeletePostContext(context.Background(), rKey)
+}
+
+func (atpClient *ATPClient) DeletePostContext(ctx context.Context, rKey string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+			Collection: atpClient.Config.PostsCollection,
+			Repo:       atpClient.Client.Auth.Did,
+			Rkey:       rKey,
+		})
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.DeletePost(rKey)
-			} else {
-				return fmt.Errorf("error deleting post: %w", err)
-			}
-		} else {
-			return fmt.Errorf("error deleting post: %w", err)
-		}
+		return fmt.Errorf("error deleting post: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return nil
 }
 
 func (atpClient *ATPClient) Repost(didOrHandle, rKey string) (*atproto.RepoCreateRecord_Output, error) {
-	postRecord, err := atpClient.GetPost(didOrHandle, rKey)
+	return atpClient.RepostContext(context.Background(), didOrHandle, rKey)
+}
+
+func (atpClient *ATPClient) RepostContext(ctx context.Context, didOrHandle, rKey string) (*atproto.RepoCreateRecord_Output, error) {
+	postRecord, err := atpClient.GetPostContext(ctx, didOrHandle, rKey)
 	if err != nil {
 		return nil, fmt.Errorf("error reposting post: %w", err)
 	}
 
-	repostResp, err := atproto.RepoCreateRecord(context.TODO(), atpClient.Client, &atproto.RepoCreateRecord_Input{
-		Collection: atpClient.Config.RepostsCollection,
-		Repo:       atpClient.Client.Auth.Did,
-		Record: &lexutil.LexiconTypeDecoder{
-			Val: &bsky.FeedRepost{
-				CreatedAt: time.Now().Local().Format(time.RFC3339),
-				Subject: &atproto.RepoStrongRef{
-					Uri: postRecord.Uri,
-					Cid: *postRecord.Cid,
+	var repostResp *atproto.RepoCreateRecord_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		repostResp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: atpClient.Config.RepostsCollection,
+			Repo:       atpClient.Client.Auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{
+				Val: &bsky.FeedRepost{
+					CreatedAt: time.Now().Local().Format(time.RFC3339),
+					Subject: &atproto.RepoStrongRef{
+						Uri: postRecord.Uri,
+						Cid: *postRecord.Cid,
+					},
 				},
 			},
-		},
+		})
+		return err
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.Repost(didOrHandle, rKey)
-			} else {
-				return nil, fmt.Errorf("error reposting post: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error reposting post: %w", err)
-		}
+		return nil, fmt.Errorf("error reposting post: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return repostResp, nil
 }
 
 func (atpClient *ATPClient) UndoRepost(rKey string) error {
-	err := atproto.RepoDeleteRecord(context.TODO(), atpClient.Client, &atproto.RepoDeleteRecord_Input{
-		Collection: atpClient.Config.RepostsCollection,
-		Repo:       atpClient.Client.Auth.Did,
-		Rkey:       rKey,
+	return atpClient.UndoRepostContext(context.Background(), rKey)
+}
+
+func (atpClient *ATPClient) UndoRepostContext(ctx context.Context, rKey string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+			Collection: atpClient.Config.RepostsCollection,
+			Repo:       atpClient.Client.Auth.Did,
+			Rkey:       rKey,
+		})
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.UndoRepost(rKey)
-			} else {
-				return fmt.Errorf("error undoing repost: %w", err)
-			}
-		} else {
-			return fmt.Errorf("error undoing repost: %w", err)
-		}
+		return fmt.Errorf("error undoing repost: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return nil
 }
 
 func (atpClient *ATPClient) Like(didOrHandle, rKey string) (*atproto.RepoCreateRecord_Output, error) {
-	postRecord, err := atpClient.GetPost(didOrHandle, rKey)
+	return atpClient.LikeContext(context.Background(), didOrHandle, rKey)
+}
+
+func (atpClient *ATPClient) LikeContext(ctx context.Context, didOrHandle, rKey string) (*atproto.RepoCreateRecord_Output, error) {
+	postRecord, err := atpClient.GetPostContext(ctx, didOrHandle, rKey)
 	if err != nil {
 		return nil, fmt.Errorf("error liking post: %w", err)
 	}
 
-	repostResp, err := atproto.RepoCreateRecord(context.TODO(), atpClient.Client, &atproto.RepoCreateRecord_Input{
-		Collection: atpClient.Config.LikesCollection,
-		Repo:       atpClient.Client.Auth.Did,
-		Record: &lexutil.LexiconTypeDecoder{
-			Val: &bsky.FeedLike{
-				CreatedAt: time.Now().Local().Format(time.RFC3339),
-				Subject: &atproto.RepoStrongRef{
-					Cid: *postRecord.Cid,
-					Uri: postRecord.Uri,
+	var repostResp *atproto.RepoCreateRecord_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		repostResp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: atpClient.Config.LikesCollection,
+			Repo:       atpClient.Client.Auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{
+				Val: &bsky.FeedLike{
+					CreatedAt: time.Now().Local().Format(time.RFC3339),
+					Subject: &atproto.RepoStrongRef{
+						Cid: *postRecord.Cid,
+						Uri: postRecord.Uri,
+					},
 				},
 			},
-		},
+		})
+		return err
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.Like(didOrHandle, rKey)
-			} else {
-				return nil, fmt.Errorf("error liking post: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error liking post: %w", err)
-		}
+		return nil, fmt.Errorf("error liking post: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return repostResp, nil
 }
 
 func (atpClient *ATPClient) Unlike(rKey string) error {
-	err := atproto.RepoDeleteRecord(context.TODO(), atpClient.Client, &atproto.RepoDeleteRecord_Input{
-		Collection: atpClient.Config.LikesCollection,
-		Repo:       atpClient.Client.Auth.Did,
-		Rkey:       rKey,
+	return atpClient.UnlikeContext(context.Background(), rKey)
+}
+
+func (atpClient *ATPClient) UnlikeContext(ctx context.Context, rKey string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+			Collection: atpClient.Config.LikesCollection,
+			Repo:       atpClient.Client.Auth.Did,
+			Rkey:       rKey,
+		})
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.Unlike(rKey)
-			} else {
-				return fmt.Errorf("error unliking post: %w", err)
-			}
-		} else {
-			return fmt.Errorf("error unliking post: %w", err)
-		}
+		return fmt.Errorf("error unliking post: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return nil
 }
 
 func (atpClient *ATPClient) UploadImages(imagePaths []string) ([]*bsky.EmbedImages_Image, error) {
+	return atpClient.UploadImagesContext(context.Background(), imagePaths)
+}
+
+func (atpClient *ATPClient) UploadImagesContext(ctx context.Context, imagePaths []string) ([]*bsky.EmbedImages_Image, error) {
 	if len(imagePaths) == 0 {
 		return nil, nil
 	}
@@ -398,30 +343,34 @@ func (atpClient *ATPClient) UploadImages(imagePaths []string) ([]*bsky.EmbedImag
 			return nil, fmt.Errorf("error uploading image: cannot read image file: %w", err)
 		}
 
-		resp, err := atproto.RepoUploadBlob(context.TODO(), atpClient.Client, bytes.NewReader(imgData))
+		blob, err := atpClient.UploadBlobContext(ctx, imgData)
 		if err != nil {
-			if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-				time.Sleep(time.Second * 3)
-
-				resp, err = atproto.RepoUploadBlob(context.TODO(), atpClient.Client, bytes.NewReader(imgData))
-				if err != nil {
-					return nil, fmt.Errorf("error uploading image: cannot upload image: %w", err)
-				}
-			} else {
-				return nil, fmt.Errorf("error uploading image: cannot upload image: %w", err)
-			}
+			return nil, fmt.Errorf("error uploading image: cannot upload image: %w", err)
 		}
 
-		images = append(images, &bsky.EmbedImages_Image{
-			Image: &lexutil.LexBlob{
-				Ref:      resp.Blob.Ref,
-				MimeType: http.DetectContentType(imgData),
-				Size:     resp.Blob.Size,
-			},
-		})
+		images = append(images, &bsky.EmbedImages_Image{Image: blob})
 	}
 
-	atpClient.RetryCount = 0
-
 	return images, nil
 }
+
+func (atpClient *ATPClient) UploadBlob(data []byte) (*lexutil.LexBlob, error) {
+	return atpClient.UploadBlobContext(context.Background(), data)
+}
+
+func (atpClient *ATPClient) UploadBlobContext(ctx context.Context, data []byte) (*lexutil.LexBlob, error) {
+	var resp *atproto.RepoUploadBlob_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoUploadBlob(ctx, atpClient.Client, bytes.NewReader(data))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error uploading blob: %w", err)
+	}
+
+	return &lexutil.LexBlob{
+		Ref:      resp.Blob.Ref,
+		MimeType: http.DetectContentType(data),
+		Size:     resp.Blob.Size,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"github.com/bluesky-social/indigo/xrpc"
+	"net/http"
+)
+
+const (
+	DefaultChatProxyDid     = "did:web:api.bsky.chat"
+	DefaultChatServiceId    = "bsky_chat"
+	DefaultLabelerProxyDid  = "did:plc:yojwcfgpkxq35sv5wioglqad"
+	DefaultLabelerServiceId = "atproto_labeler"
+
+	proxyHeader = "Atproto-Proxy"
+)
+
+// ProxyTarget formats the Atproto-Proxy value for a service of did, e.g.
+// "did:web:api.bsky.chat#bsky_chat".
+func ProxyTarget(did, serviceId string) string {
+	return did + "#" + serviceId
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+func (config *Config) chatProxy() string {
+	return ProxyTarget(
+		orDefault(config.ChatProxyDid, DefaultChatProxyDid), orDefault(config.ChatServiceId, DefaultChatServiceId))
+}
+
+func (config *Config) labelerProxy() string {
+	return ProxyTarget(
+		orDefault(config.LabelerProxyDid, DefaultLabelerProxyDid),
+		orDefault(config.LabelerServiceId, DefaultLabelerServiceId))
+}
+
+type proxyKey struct{}
+
+// ContextWithProxy overrides the Atproto-Proxy header for every request made with
+// ctx, whichever of Client, PdsClient or LabelerClient is used. It lets a single
+// call reach a different service, e.g. a test chat service with
+// atpClient.SendMessageContext(api.ContextWithProxy(ctx, target), ...).
+func ContextWithProxy(ctx context.Context, target string) context.Context {
+	return context.WithValue(ctx, proxyKey{}, target)
+}
+
+type proxyTransport struct {
+	base http.RoundTripper
+}
+
+func (transport *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if target, ok := req.Context().Value(proxyKey{}).(string); ok && target != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(proxyHeader, target)
+	}
+
+	return transport.base.RoundTrip(req)
+}
+
+func (atpClient *ATPClient) newProxiedClient(host, target string) *xrpc.Client {
+	return atpClient.attach(&xrpc.Client{
+		Host:    host,
+		Auth:    atpClient.Client.Auth,
+		Headers: map[string]string{proxyHeader: target},
+	})
+}
+
+type labelerKey struct{}
+
+// ContextWithLabeler makes the Ozone methods (SearchRepos, QueryLabel, LabelAccount
+// and the others) called with ctx talk to the labeler labelerDid instead of the
+// configured one. An empty serviceId means DefaultLabelerServiceId. The calls keep
+// going through the client, so they are retried and renew the session as usual.
+func ContextWithLabeler(ctx context.Context, labelerDid, serviceId string) context.Context {
+	return context.WithValue(ctx, labelerKey{}, ProxyTarget(labelerDid, orDefault(serviceId, DefaultLabelerServiceId)))
+}
+
+// invokeLabeler runs an Ozone call, proxied to the labeler selected with
+// ContextWithLabeler if there is one.
+func (atpClient *ATPClient) invokeLabeler(ctx context.Context, call func(ctx context.Context) error) error {
+	if target, ok := ctx.Value(labelerKey{}).(string); ok {
+		ctx = ContextWithProxy(ctx, target)
+	}
+
+	return atpClient.invoke(ctx, call)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestContextWithLabeler(t *testing.T) {
+	pds := newTestPDS(t)
+
+	// answer the Ozone endpoints in place of the labeler and note the proxy target
+	var mu sync.Mutex
+	var targets []string
+	labeler := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !strings.Contains(req.URL.Path, "tools.ozone.") {
+				return next.RoundTrip(req)
+			}
+
+			mu.Lock()
+			targets = append(targets, req.Header.Get(proxyHeader))
+			mu.Unlock()
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"repos":[]}`)),
+				Request:    req,
+			}, nil
+		})
+	}
+
+	atpClient, err := ClientContext(context.Background(), testDid, testAppPassword, newTestConfig(pds.URL),
+		WithSessionStore(NewMemorySessionStore()), WithMiddleware(labeler))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "configured labeler", ctx: context.Background(), want: atpClient.Config.labelerProxy()},
+		{
+			name: "selected labeler",
+			ctx:  ContextWithLabeler(context.Background(), "did:plc:otherlabeler", ""),
+			want: "did:plc:otherlabeler#" + DefaultLabelerServiceId,
+		},
+		{
+			name: "selected labeler and service",
+			ctx:  ContextWithLabeler(context.Background(), "did:web:ozone.example.com", "moderation"),
+			want: "did:web:ozone.example.com#moderation",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mu.Lock()
+			targets = nil
+			mu.Unlock()
+
+			if _, err := atpClient.SearchReposContext(test.ctx, "spam", "", 10); err != nil {
+				t.Fatalf("searching repos: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(targets) != 1 || targets[0] != test.want {
+				t.Errorf("proxy targets = %v, want [%s]", targets, test.want)
+			}
+		})
+	}
+}
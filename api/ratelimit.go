@@ -0,0 +1,408 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/suvpen/suvatp/atperr"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WriteCreate = "create"
+	WriteUpdate = "update"
+	WriteDelete = "delete"
+
+	createRecordNSID = "com.atproto.repo.createRecord"
+	putRecordNSID    = "com.atproto.repo.putRecord"
+	deleteRecordNSID = "com.atproto.repo.deleteRecord"
+	applyWritesNSID  = "com.atproto.repo.applyWrites"
+)
+
+// ErrRateLimitExhausted is returned instead of waiting when a budget is used up and
+// the client was created with WithRateLimitFailFast.
+var ErrRateLimitExhausted = errors.New("rate limit budget exhausted")
+
+// WriteLimits follows the PDS points model: a create costs 3 points, an update 2 and
+// a delete 1, out of 5000 points per hour and 35000 per day. Each operation gets its
+// own buckets sized so that it alone stays within those budgets.
+type WriteLimits struct {
+	CreatesPerHour int `json:"creates_per_hour"`
+	UpdatesPerHour int `json:"updates_per_hour"`
+	DeletesPerHour int `json:"deletes_per_hour"`
+	CreatesPerDay  int `json:"creates_per_day"`
+	UpdatesPerDay  int `json:"updates_per_day"`
+	DeletesPerDay  int `json:"deletes_per_day"`
+}
+
+func DefaultWriteLimits() WriteLimits {
+	return WriteLimits{
+		CreatesPerHour: 5000 / 3,
+		UpdatesPerHour: 5000 / 2,
+		DeletesPerHour: 5000,
+		CreatesPerDay:  35000 / 3,
+		UpdatesPerDay:  35000 / 2,
+		DeletesPerDay:  35000,
+	}
+}
+
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+	updated  time.Time
+}
+
+func newTokenBucket(capacity int, period time.Duration) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		rate:     float64(capacity) / period.Seconds(),
+		updated:  time.Now(),
+	}
+}
+
+func (bucket *tokenBucket) refill(now time.Time) {
+	bucket.tokens = math.Min(bucket.capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*bucket.rate)
+	bucket.updated = now
+}
+
+// wait returns how long it takes until n tokens are available.
+func (bucket *tokenBucket) wait(n float64) time.Duration {
+	if bucket.tokens >= n {
+		return 0
+	}
+
+	return time.Duration((n - bucket.tokens) / bucket.rate * float64(time.Second))
+}
+
+// RateLimiter paces writes on the client side so bulk jobs stay under the PDS write
+// limits instead of running into 429s. A limiter can be shared between clients of
+// the same account with WithRateLimiter.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string][]*tokenBucket
+}
+
+func NewRateLimiter(limits WriteLimits) *RateLimiter {
+	limiter := &RateLimiter{buckets: make(map[string][]*tokenBucket)}
+
+	add := func(operation string, perHour, perDay int) {
+		if perHour > 0 {
+			limiter.buckets[operation] = append(limiter.buckets[operation], newTokenBucket(perHour, time.Hour))
+		}
+		if perDay > 0 {
+			limiter.buckets[operation] = append(limiter.buckets[operation], newTokenBucket(perDay, time.Hour*24))
+		}
+	}
+
+	add(WriteCreate, limits.CreatesPerHour, limits.CreatesPerDay)
+	add(WriteUpdate, limits.UpdatesPerHour, limits.UpdatesPerDay)
+	add(WriteDelete, limits.DeletesPerHour, limits.DeletesPerDay)
+
+	return limiter
+}
+
+// Available returns how many writes of the operation can be made right now.
+func (limiter *RateLimiter) Available(operation string) int {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	available := math.MaxInt
+	now := time.Now()
+
+	for _, bucket := range limiter.buckets[operation] {
+		bucket.refill(now)
+		available = min(available, int(bucket.tokens))
+	}
+
+	return available
+}
+
+// reserve takes n tokens for operation, or returns how long to wait before trying again.
+func (limiter *RateLimiter) reserve(operation string, n int) (time.Duration, error) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := time.Now()
+
+	var wait time.Duration
+	for _, bucket := range limiter.buckets[operation] {
+		if float64(n) > bucket.capacity {
+			return 0, fmt.Errorf("%w: %d %s writes exceed the bucket size of %d",
+				ErrRateLimitExhausted, n, operation, int(bucket.capacity))
+		}
+
+		bucket.refill(now)
+		wait = max(wait, bucket.wait(float64(n)))
+	}
+
+	if wait > 0 {
+		return wait, nil
+	}
+
+	for _, bucket := range limiter.buckets[operation] {
+		bucket.tokens -= float64(n)
+	}
+
+	return 0, nil
+}
+
+// Acquire takes n writes of the operation from the budget, waiting for them to become
+// available unless failFast is set.
+func (limiter *RateLimiter) Acquire(ctx context.Context, operation string, n int, failFast bool) error {
+	for {
+		wait, err := limiter.reserve(operation, n)
+		if err != nil || wait == 0 {
+			return err
+		}
+
+		if failFast {
+			return fmt.Errorf("%w: %s writes available again in %s", ErrRateLimitExhausted, operation, wait.Round(time.Second))
+		}
+
+		if err = sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// rateLimitState keeps the latest ratelimit-* headers the server sent for each endpoint.
+type rateLimitState struct {
+	mu     sync.Mutex
+	limits map[string]atperr.RateLimit
+}
+
+func newRateLimitState() *rateLimitState {
+	return &rateLimitState{limits: make(map[string]atperr.RateLimit)}
+}
+
+func (state *rateLimitState) get(endpoint string) (atperr.RateLimit, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	limit, ok := state.limits[endpoint]
+	return limit, ok
+}
+
+// record keeps the budget of a response. Without a readable limit and remaining count
+// the budget stays as it was, so a malformed header never holds requests back.
+func (state *rateLimitState) record(endpoint string, header http.Header) {
+	limit, err := strconv.Atoi(header.Get("ratelimit-limit"))
+	if err != nil {
+		return
+	}
+
+	remaining, err := strconv.Atoi(header.Get("ratelimit-remaining"))
+	if err != nil {
+		return
+	}
+
+	rateLimit := atperr.RateLimit{Limit: limit, Remaining: remaining, Policy: header.Get("ratelimit-policy")}
+	if reset, err := strconv.ParseInt(header.Get("ratelimit-reset"), 10, 64); err == nil {
+		rateLimit.Reset = time.Unix(reset, 0)
+	}
+
+	state.mu.Lock()
+	state.limits[endpoint] = rateLimit
+	state.mu.Unlock()
+}
+
+// RateLimit returns the budget the server last reported for the endpoint NSID, e.g.
+// "com.atproto.repo.createRecord".
+func (atpClient *ATPClient) RateLimit(endpoint string) (atperr.RateLimit, bool) {
+	if atpClient.rateLimits == nil {
+		return atperr.RateLimit{}, false
+	}
+
+	return atpClient.rateLimits.get(endpoint)
+}
+
+// RateLimits returns the budgets the server last reported, keyed by endpoint NSID.
+func (atpClient *ATPClient) RateLimits() map[string]atperr.RateLimit {
+	limits := make(map[string]atperr.RateLimit)
+	if atpClient.rateLimits == nil {
+		return limits
+	}
+
+	atpClient.rateLimits.mu.Lock()
+	defer atpClient.rateLimits.mu.Unlock()
+
+	for endpoint, limit := range atpClient.rateLimits.limits {
+		limits[endpoint] = limit
+	}
+
+	return limits
+}
+
+// RateLimiter returns the client-side write limiter, nil if disabled.
+func (atpClient *ATPClient) RateLimiter() *RateLimiter {
+	return atpClient.limiter
+}
+
+// errPaced is returned by rateLimitTransport for a request it held back on behalf of
+// invoke, which waits for retryHint.pace and sends the request again.
+var errPaced = errors.New("request held back by rate limit")
+
+// rateLimitTransport holds requests back while the server budget of their endpoint is
+// exhausted, charges repository writes to the limiter and records the budgets the
+// server reports. Requests made through invoke are not held here: the wait is handed
+// to invoke through their retryHint.
+type rateLimitTransport struct {
+	base     http.RoundTripper
+	limiter  *RateLimiter
+	state    *rateLimitState
+	failFast bool
+}
+
+func (transport *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	endpoint := strings.TrimPrefix(req.URL.Path, "/xrpc/")
+	hint, _ := ctx.Value(retryHintKey{}).(*retryHint)
+
+	if limit, ok := transport.state.get(endpoint); ok && limit.Remaining <= 0 {
+		if wait := time.Until(limit.Reset); wait > 0 {
+			if err := transport.hold(ctx, hint, wait, fmt.Sprintf("%s resets", endpoint)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if transport.limiter != nil && req.Method == http.MethodPost {
+		writes, counted, err := countWrites(req, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		req = counted
+
+		for _, operation := range []string{WriteCreate, WriteUpdate, WriteDelete} {
+			if writes[operation] == 0 || (hint != nil && hint.charged[operation]) {
+				continue
+			}
+
+			if err = transport.acquire(ctx, hint, operation, writes[operation]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resp, err := transport.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	transport.state.record(endpoint, resp.Header)
+
+	return resp, nil
+}
+
+// hold waits for a budget to recover, or hands the wait to invoke when hint is set.
+func (transport *rateLimitTransport) hold(ctx context.Context, hint *retryHint, wait time.Duration, what string) error {
+	if transport.failFast {
+		return fmt.Errorf("%w: %s in %s", ErrRateLimitExhausted, what, wait.Round(time.Second))
+	}
+
+	if hint != nil {
+		hint.pace = wait
+		return errPaced
+	}
+
+	return sleepContext(ctx, wait)
+}
+
+// acquire charges n writes of the operation to the limiter, once per invoke.
+func (transport *rateLimitTransport) acquire(ctx context.Context, hint *retryHint, operation string, n int) error {
+	if hint == nil {
+		return transport.limiter.Acquire(ctx, operation, n, transport.failFast)
+	}
+
+	wait, err := transport.limiter.reserve(operation, n)
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		return transport.hold(ctx, hint, wait, fmt.Sprintf("%s writes available again", operation))
+	}
+
+	hint.charged[operation] = true
+
+	return nil
+}
+
+// countWrites classifies a repository write request by operation. The body of
+// applyWrites is read from GetBody to count its operations; a request without
+// GetBody is cloned with a buffered body, which is returned in place of req.
+func countWrites(req *http.Request, endpoint string) (map[string]int, *http.Request, error) {
+	switch endpoint {
+	case createRecordNSID:
+		return map[string]int{WriteCreate: 1}, req, nil
+	case putRecordNSID:
+		return map[string]int{WriteUpdate: 1}, req, nil
+	case deleteRecordNSID:
+		return map[string]int{WriteDelete: 1}, req, nil
+	case applyWritesNSID:
+	default:
+		return nil, req, nil
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+
+	var body []byte
+	var err error
+
+	if req.GetBody != nil {
+		var bodyCopy io.ReadCloser
+		if bodyCopy, err = req.GetBody(); err != nil {
+			return nil, nil, fmt.Errorf("error reading %s request: %w", endpoint, err)
+		}
+
+		body, err = io.ReadAll(bodyCopy)
+		bodyCopy.Close()
+	} else {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %s request: %w", endpoint, err)
+	}
+
+	var input struct {
+		Writes []struct {
+			Type string `json:"$type"`
+		} `json:"writes"`
+	}
+	if err = json.Unmarshal(body, &input); err != nil {
+		return nil, nil, fmt.Errorf("error unmarshalling %s request: %w", endpoint, err)
+	}
+
+	writes := make(map[string]int)
+	for _, write := range input.Writes {
+		switch {
+		case strings.HasSuffix(write.Type, "#create"):
+			writes[WriteCreate]++
+		case strings.HasSuffix(write.Type, "#update"):
+			writes[WriteUpdate]++
+		case strings.HasSuffix(write.Type, "#delete"):
+			writes[WriteDelete]++
+		}
+	}
+
+	return writes, req, nil
+}
@@ -0,0 +1,385 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestLimiter returns a limiter with a single bucket per operation that refills
+// completely within period.
+func newTestLimiter(capacity int, period time.Duration) *RateLimiter {
+	return &RateLimiter{buckets: map[string][]*tokenBucket{
+		WriteCreate: {newTokenBucket(capacity, period)},
+		WriteUpdate: {newTokenBucket(capacity, period)},
+		WriteDelete: {newTokenBucket(capacity, period)},
+	}}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name     string
+		tokens   float64
+		elapsed  time.Duration
+		want     float64
+		wantWait time.Duration
+	}{
+		{name: "empty bucket refills at its rate", tokens: 0, elapsed: 3 * time.Second, want: 3, wantWait: 2 * time.Second},
+		{name: "refill is capped at capacity", tokens: 5, elapsed: time.Hour, want: 10},
+		{name: "no time passed", tokens: 4, elapsed: 0, want: 4, wantWait: time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bucket := newTokenBucket(10, 10*time.Second)
+			bucket.tokens = test.tokens
+			bucket.updated = start
+
+			bucket.refill(start.Add(test.elapsed))
+
+			if bucket.tokens != test.want {
+				t.Errorf("tokens = %v, want %v", bucket.tokens, test.want)
+			}
+			if got := bucket.wait(5); got != test.wantWait {
+				t.Errorf("wait(5) = %s, want %s", got, test.wantWait)
+			}
+		})
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	tests := []struct {
+		name          string
+		used          int
+		n             int
+		wantWait      bool
+		wantErr       error
+		wantAvailable int
+	}{
+		{name: "within budget", n: 3, wantAvailable: 7},
+		{name: "whole budget", n: 10, wantAvailable: 0},
+		{name: "budget used up", used: 8, n: 3, wantWait: true, wantAvailable: 2},
+		{name: "more than a bucket holds", n: 11, wantErr: ErrRateLimitExhausted, wantAvailable: 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := newTestLimiter(10, time.Hour)
+			if test.used > 0 {
+				if _, err := limiter.reserve(WriteCreate, test.used); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			wait, err := limiter.reserve(WriteCreate, test.n)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+			if (wait > 0) != test.wantWait {
+				t.Errorf("wait = %s, want a wait: %v", wait, test.wantWait)
+			}
+
+			// a reservation that has to wait takes nothing from the budget
+			if got := limiter.Available(WriteCreate); got != test.wantAvailable {
+				t.Errorf("available = %d, want %d", got, test.wantAvailable)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		failFast bool
+		timeout  time.Duration
+		wantErr  error
+	}{
+		{name: "fail fast", failFast: true, timeout: time.Second, wantErr: ErrRateLimitExhausted},
+		{name: "blocks until refilled", timeout: time.Second},
+		{name: "blocking gives up with the context", timeout: 10 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := newTestLimiter(1, 100*time.Millisecond)
+			if err := limiter.Acquire(context.Background(), WriteCreate, 1, false); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := limiter.Acquire(ctx, WriteCreate, 1, test.failFast)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+
+			if test.wantErr == nil && time.Since(start) < 50*time.Millisecond {
+				t.Errorf("acquired after %s, want a wait for the refill", time.Since(start))
+			}
+			if test.failFast && time.Since(start) > 50*time.Millisecond {
+				t.Errorf("failed after %s, want no wait", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestCountWrites(t *testing.T) {
+	applyWritesBody := `{"repo":"did:plc:testaccount","writes":[` +
+		`{"$type":"com.atproto.repo.applyWrites#create","collection":"app.bsky.graph.block"},` +
+		`{"$type":"com.atproto.repo.applyWrites#create","collection":"app.bsky.graph.block"},` +
+		`{"$type":"com.atproto.repo.applyWrites#update","collection":"app.bsky.actor.profile"},` +
+		`{"$type":"com.atproto.repo.applyWrites#delete","collection":"app.bsky.graph.follow"}]}`
+
+	tests := []struct {
+		name       string
+		endpoint   string
+		body       string
+		noGetBody  bool
+		want       map[string]int
+		wantErrMsg string
+	}{
+		{name: "createRecord", endpoint: createRecordNSID, body: `{}`, want: map[string]int{WriteCreate: 1}},
+		{name: "putRecord", endpoint: putRecordNSID, body: `{}`, want: map[string]int{WriteUpdate: 1}},
+		{name: "deleteRecord", endpoint: deleteRecordNSID, body: `{}`, want: map[string]int{WriteDelete: 1}},
+		{
+			name: "applyWrites with GetBody", endpoint: applyWritesNSID, body: applyWritesBody,
+			want: map[string]int{WriteCreate: 2, WriteUpdate: 1, WriteDelete: 1},
+		},
+		{
+			name: "applyWrites without GetBody", endpoint: applyWritesNSID, body: applyWritesBody, noGetBody: true,
+			want: map[string]int{WriteCreate: 2, WriteUpdate: 1, WriteDelete: 1},
+		},
+		{name: "applyWrites without writes", endpoint: applyWritesNSID, body: `{"writes":[]}`, want: map[string]int{}},
+		{name: "applyWrites with a broken body", endpoint: applyWritesNSID, body: `{`, wantErrMsg: "unmarshalling"},
+		{name: "not a write", endpoint: "app.bsky.feed.getTimeline", body: `{}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "https://pds.example.com/xrpc/"+test.endpoint,
+				bytes.NewReader([]byte(test.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.noGetBody {
+				req.Body = io.NopCloser(strings.NewReader(test.body))
+				req.GetBody = nil
+			}
+
+			writes, counted, err := countWrites(req, test.endpoint)
+			if test.wantErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErrMsg) {
+					t.Fatalf("err = %v, want it to mention %s", err, test.wantErrMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(writes) != len(test.want) {
+				t.Errorf("writes = %v, want %v", writes, test.want)
+			}
+			for operation, n := range test.want {
+				if writes[operation] != n {
+					t.Errorf("%s writes = %d, want %d", operation, writes[operation], n)
+				}
+			}
+
+			// the request that is sent must still carry the whole body
+			body, err := io.ReadAll(counted.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != test.body {
+				t.Errorf("body after counting = %q, want %q", body, test.body)
+			}
+
+			if test.noGetBody && test.endpoint == applyWritesNSID {
+				if counted == req || counted.GetBody == nil {
+					t.Error("request without GetBody was not replaced by a buffered clone")
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitTransportHoldsExhaustedEndpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining string
+		failFast  bool
+		withHint  bool
+		wantErr   error
+		wantSent  int64
+	}{
+		{name: "fail fast", remaining: "0", failFast: true, wantErr: ErrRateLimitExhausted, wantSent: 1},
+		{name: "wait handed to invoke", remaining: "0", withHint: true, wantErr: errPaced, wantSent: 1},
+		{name: "budget left", remaining: "5", failFast: true, wantSent: 2},
+		{name: "missing remaining", remaining: "", failFast: true, wantSent: 2},
+		{name: "malformed remaining", remaining: "many", failFast: true, wantSent: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sent atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent.Add(1)
+
+				w.Header().Set("ratelimit-limit", "3000")
+				if test.remaining != "" {
+					w.Header().Set("ratelimit-remaining", test.remaining)
+				}
+				w.Header().Set("ratelimit-reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+				w.Header().Set("ratelimit-policy", "3000;w=300")
+				writeJSON(w, http.StatusOK, map[string]string{})
+			}))
+			defer server.Close()
+
+			state := newRateLimitState()
+			client := &http.Client{Transport: &rateLimitTransport{
+				base: http.DefaultTransport, state: state, failFast: test.failFast}}
+
+			get := func(ctx context.Context) error {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/xrpc/app.bsky.feed.getTimeline", nil)
+				if err != nil {
+					return err
+				}
+
+				resp, err := client.Do(req)
+				if err != nil {
+					return err
+				}
+				return resp.Body.Close()
+			}
+
+			if err := get(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, hint := context.Background(), (*retryHint)(nil)
+			if test.withHint {
+				ctx, hint = withRetryHint(ctx, make(map[string]bool))
+			}
+
+			if err := get(ctx); !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+
+			if hint != nil && hint.pace < 59*time.Minute {
+				t.Errorf("pace = %s, want the time until the reset", hint.pace)
+			}
+			if got := sent.Load(); got != test.wantSent {
+				t.Errorf("requests sent = %d, want %d", got, test.wantSent)
+			}
+
+			_, recorded := state.get("app.bsky.feed.getTimeline")
+			if wantRecorded := test.remaining == "0" || test.remaining == "5"; recorded != wantRecorded {
+				t.Errorf("budget recorded = %v, want %v", recorded, wantRecorded)
+			}
+		})
+	}
+}
+
+func TestRateLimitTransportPacesWritesThroughHint(t *testing.T) {
+	limiter := newTestLimiter(1, time.Hour)
+	if _, err := limiter.reserve(WriteCreate, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent atomic.Int64
+	client := &http.Client{Transport: &rateLimitTransport{
+		base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sent.Add(1)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}),
+		limiter: limiter,
+		state:   newRateLimitState(),
+	}}
+
+	ctx, hint := withRetryHint(context.Background(), make(map[string]bool))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://pds.example.com/xrpc/"+createRecordNSID, strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = client.Do(req); !errors.Is(err, errPaced) {
+		t.Fatalf("err = %v, want %v", err, errPaced)
+	}
+	if hint.pace <= 0 || hint.charged[WriteCreate] {
+		t.Errorf("pace = %s, charged = %v; want a pace and nothing charged", hint.pace, hint.charged)
+	}
+	if sent.Load() != 0 {
+		t.Error("paced request was sent")
+	}
+}
+
+func TestInvokeChargesWritesOnce(t *testing.T) {
+	pds := newTestPDS(t)
+
+	// the first two attempts of every post fail upstream and are retried by invoke
+	var attempts atomic.Int64
+	failFirstAttempts := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if strings.HasSuffix(req.URL.Path, createRecordNSID) && attempts.Add(1)%3 != 0 {
+				return &http.Response{
+					StatusCode: http.StatusBadGateway,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(`{"error":"UpstreamFailure","message":"Upstream Failure"}`)),
+					Request:    req,
+				}, nil
+			}
+
+			return next.RoundTrip(req)
+		})
+	}
+
+	config := newTestConfig(pds.URL)
+	config.RetryPolicy = &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+		RetryOn:     []string{RetryOnUpstreamFailure},
+	}
+
+	limiter := newTestLimiter(10, time.Hour)
+	atpClient, err := ClientContext(context.Background(), testDid, testAppPassword, config,
+		WithSessionStore(NewMemorySessionStore()), WithRateLimiter(limiter), WithMiddleware(failFirstAttempts))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	for posts := 1; posts <= 2; posts++ {
+		if _, err = atpClient.Post(&bsky.FeedPost{Text: "hello", CreatedAt: time.Now().Format(time.RFC3339)}); err != nil {
+			t.Fatalf("post: %v", err)
+		}
+
+		if got, want := limiter.Available(WriteCreate), 10-posts; got != want {
+			t.Errorf("after %d posts: available creates = %d, want %d", posts, got, want)
+		}
+	}
+
+	if got := attempts.Load(); got != 6 {
+		t.Errorf("attempts = %d, want 6", got)
+	}
+}
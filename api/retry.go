@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"github.com/suvpen/suvatp/atperr"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RetryOnUpstreamFailure     = "UpstreamFailure"
+	RetryOnUpstreamTimeout     = "UpstreamTimeout"
+	RetryOnInternalServerError = "InternalServerError"
+	RetryOnRateLimited         = "RateLimited"
+
+	legacyRetryDelay = time.Second * 3
+)
+
+// RetryPolicy controls how failed XRPC calls are retried. Delays grow exponentially
+// from BaseDelay up to MaxDelay, reduced by a random fraction of up to Jitter. A wait
+// requested by the server through Retry-After or ratelimit-reset replaces the computed
+// delay; when it exceeds MaxDelay the call fails instead of blocking.
+type RetryPolicy struct {
+	MaxAttempts int           `json:"max_attempts"`
+	BaseDelay   time.Duration `json:"base_delay"`
+	MaxDelay    time.Duration `json:"max_delay"`
+	Jitter      float64       `json:"jitter"`
+	RetryOn     []string      `json:"retry_on"`
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Second * 30,
+		Jitter:      0.2,
+		RetryOn: []string{
+			RetryOnUpstreamFailure, RetryOnUpstreamTimeout, RetryOnInternalServerError, RetryOnRateLimited},
+	}
+}
+
+// retryPolicy falls back to the fixed three second delay used before RetryPolicy existed.
+func (config *Config) retryPolicy() *RetryPolicy {
+	if config.RetryPolicy != nil {
+		return config.RetryPolicy
+	}
+
+	return &RetryPolicy{
+		MaxAttempts: config.Retries + 1,
+		BaseDelay:   legacyRetryDelay,
+		MaxDelay:    legacyRetryDelay,
+		RetryOn:     []string{RetryOnUpstreamFailure, RetryOnUpstreamTimeout, RetryOnInternalServerError},
+	}
+}
+
+func errorClass(err error) string {
+	atpErr, ok := atperr.AsATPError(err)
+
+	switch {
+	case ok && atpErr.StatusCode == http.StatusTooManyRequests, atperr.IsRateLimitExceededError(err):
+		return RetryOnRateLimited
+	case atperr.IsUpstreamFailureError(err):
+		return RetryOnUpstreamFailure
+	case atperr.IsUpstreamTimeoutError(err):
+		return RetryOnUpstreamTimeout
+	case atperr.IsInternalServerError(err):
+		return RetryOnInternalServerError
+	default:
+		return ""
+	}
+}
+
+func (policy *RetryPolicy) retryable(err error) bool {
+	class := errorClass(err)
+	if class == "" {
+		return false
+	}
+
+	for _, retryOn := range policy.RetryOn {
+		if retryOn == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+// delay returns how long to wait before the given retry (starting at 1), and false
+// when the server asked for a longer wait than MaxDelay allows.
+func (policy *RetryPolicy) delay(retry int, err error, hint *retryHint) (time.Duration, bool) {
+	if wait := serverWait(err, hint); wait > 0 {
+		return wait, wait <= policy.MaxDelay
+	}
+
+	wait := policy.BaseDelay
+	for i := 1; i < retry && wait < policy.MaxDelay; i++ {
+		wait *= 2
+	}
+
+	if wait > policy.MaxDelay {
+		wait = policy.MaxDelay
+	}
+
+	if policy.Jitter > 0 {
+		wait -= time.Duration(rand.Float64() * policy.Jitter * float64(wait))
+	}
+
+	return wait, true
+}
+
+func serverWait(err error, hint *retryHint) time.Duration {
+	if hint.retryAfter > 0 {
+		return hint.retryAfter
+	}
+
+	atpErr, ok := atperr.AsATPError(err)
+	if ok && atpErr.StatusCode == http.StatusTooManyRequests && atpErr.RateLimit != nil {
+		return time.Until(atpErr.RateLimit.Reset)
+	}
+
+	return 0
+}
+
+type retryHintKey struct{}
+
+// retryHint carries the Retry-After of the latest response back to invoke, since
+// xrpc.Error only keeps the ratelimit-* headers, along with the NSID of the endpoint
+// that was called so errors can be attributed to it.
+//
+// rateLimitTransport sets pace instead of waiting for a budget itself, so invoke can
+// wait without holding the session lock. charged is shared by all attempts of one
+// invoke and keeps the write limiter from being charged again on retries.
+type retryHint struct {
+	retryAfter time.Duration
+	endpoint   string
+	pace       time.Duration
+	charged    map[string]bool
+}
+
+func withRetryHint(ctx context.Context, charged map[string]bool) (context.Context, *retryHint) {
+	hint := &retryHint{charged: charged}
+	return context.WithValue(ctx, retryHintKey{}, hint), hint
+}
+
+type retryHintTransport struct {
+	base http.RoundTripper
+}
+
+func (transport *retryHintTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	hint, _ := req.Context().Value(retryHintKey{}).(*retryHint)
+	if hint != nil {
+		hint.endpoint = strings.TrimPrefix(req.URL.Path, "/xrpc/")
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if hint != nil {
+		hint.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+
+	return resp, nil
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+
+	return 0
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/bluesky-social/indigo/xrpc"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	getServiceAuthNSID = "com.atproto.server.getServiceAuth"
+
+	DefaultServiceAuthTTL = time.Minute
+
+	serviceTokenMargin = time.Second * 15
+)
+
+type serviceAuthOutput struct {
+	Token string `json:"token"`
+}
+
+func (atpClient *ATPClient) GetServiceAuth(audience, method string, expiresAt time.Time) (string, error) {
+	return atpClient.GetServiceAuthContext(context.Background(), audience, method, expiresAt)
+}
+
+// GetServiceAuthContext mints an inter-service JWT for the service DID audience. The
+// token is bound to the lexicon method when one is given; a zero expiresAt leaves
+// the lifetime to the PDS, which only accepts short lifetimes for unbound tokens.
+func (atpClient *ATPClient) GetServiceAuthContext(
+	ctx context.Context, audience, method string, expiresAt time.Time) (string, error) {
+	params := map[string]interface{}{
+		"aud": audience,
+	}
+	if method != "" {
+		params["lxm"] = method
+	}
+	if !expiresAt.IsZero() {
+		params["exp"] = expiresAt.Unix()
+	}
+
+	var out serviceAuthOutput
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atpClient.Client.Do(ctx, xrpc.Query, "", getServiceAuthNSID, params, nil, &out)
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting service auth for %s: %w", audience, err)
+	}
+
+	return out.Token, nil
+}
+
+type serviceToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// serviceTokenMint is a token being minted; the requests waiting for it share it.
+type serviceTokenMint struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// serviceAuthTransport authenticates every request with a service token minted for
+// its method, minting a new one shortly before the cached one expires.
+type serviceAuthTransport struct {
+	base      http.RoundTripper
+	atpClient *ATPClient
+	audience  string
+	method    string
+	ttl       time.Duration
+
+	// mu only guards the maps; tokens are minted without holding it
+	mu      sync.Mutex
+	tokens  map[string]serviceToken
+	minting map[string]*serviceTokenMint
+}
+
+func (transport *serviceAuthTransport) token(ctx context.Context, method string) (string, error) {
+	transport.mu.Lock()
+	if cached, ok := transport.tokens[method]; ok && time.Until(cached.expiresAt) > serviceTokenMargin {
+		transport.mu.Unlock()
+		return cached.token, nil
+	}
+
+	mint, minting := transport.minting[method]
+	if !minting {
+		mint = &serviceTokenMint{done: make(chan struct{})}
+		transport.minting[method] = mint
+	}
+	transport.mu.Unlock()
+
+	if !minting {
+		transport.mint(ctx, method, mint)
+	}
+
+	select {
+	case <-mint.done:
+		return mint.token, mint.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (transport *serviceAuthTransport) mint(ctx context.Context, method string, mint *serviceTokenMint) {
+	expiresAt := time.Now().Add(transport.ttl)
+	token, err := transport.atpClient.GetServiceAuthContext(ctx, transport.audience, method, expiresAt)
+
+	transport.mu.Lock()
+	if err == nil {
+		transport.tokens[method] = serviceToken{token: token, expiresAt: expiresAt}
+	}
+	delete(transport.minting, method)
+	transport.mu.Unlock()
+
+	mint.token, mint.err = token, err
+	close(mint.done)
+}
+
+func (transport *serviceAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := transport.method
+	if method == "" {
+		method = strings.TrimPrefix(req.URL.Path, "/xrpc/")
+	}
+
+	token, err := transport.token(req.Context(), method)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return transport.base.RoundTrip(req)
+}
+
+// ServiceClient returns an xrpc.Client for a third-party service such as a feed
+// generator or labeler at host, whose service DID is audience. Requests carry a
+// service token minted by the PDS and renewed before it expires. With an empty
+// method each called method gets its own bound token; ttl defaults to
+// DefaultServiceAuthTTL.
+func (atpClient *ATPClient) ServiceClient(host, audience, method string, ttl time.Duration) *xrpc.Client {
+	if ttl <= 0 {
+		ttl = DefaultServiceAuthTTL
+	}
+
+	// the service's ratelimit-* headers must not hold back or pace PDS calls
+	base := http.DefaultTransport
+	if atpClient.serviceTransport != nil {
+		base = atpClient.serviceTransport
+	}
+
+	httpClient := &http.Client{
+		Transport: &serviceAuthTransport{
+			base:      base,
+			atpClient: atpClient,
+			audience:  audience,
+			method:    method,
+			ttl:       max(ttl, serviceTokenMargin*2),
+			tokens:    make(map[string]serviceToken),
+			minting:   make(map[string]*serviceTokenMint),
+		},
+	}
+	if atpClient.httpClient != nil {
+		httpClient.Timeout = atpClient.httpClient.Timeout
+	}
+
+	serviceClient := atpClient.attach(&xrpc.Client{Host: host})
+	serviceClient.Client = httpClient
+
+	return serviceClient
+}
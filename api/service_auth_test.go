@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServiceClientKeepsOutOfPDSBudgets(t *testing.T) {
+	pds := newTestPDS(t)
+
+	var mints atomic.Int64
+	mintServiceTokens := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !strings.HasSuffix(req.URL.Path, "com.atproto.server.getServiceAuth") {
+				return next.RoundTrip(req)
+			}
+
+			mints.Add(1)
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"token":"service-token"}`)),
+				Request:    req,
+			}, nil
+		})
+	}
+
+	// a feed generator that reports its own budget as used up
+	var authorization atomic.Value
+	feedGenerator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+
+		w.Header().Set("ratelimit-limit", "100")
+		w.Header().Set("ratelimit-remaining", "0")
+		w.Header().Set("ratelimit-reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		writeJSON(w, http.StatusOK, map[string]any{"feed": []any{}})
+	}))
+	defer feedGenerator.Close()
+
+	limiter := newTestLimiter(10, time.Hour)
+	atpClient, err := ClientContext(context.Background(), testDid, testAppPassword, newTestConfig(pds.URL),
+		WithSessionStore(NewMemorySessionStore()), WithRateLimiter(limiter), WithRateLimitFailFast(),
+		WithMiddleware(mintServiceTokens))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	serviceClient := atpClient.ServiceClient(feedGenerator.URL, "did:web:feed.example.com", "", 0)
+	for i := 0; i < 2; i++ {
+		if _, err = bsky.FeedGetFeedSkeleton(context.Background(), serviceClient, "", "at://feed", 10); err != nil {
+			t.Fatalf("getting feed skeleton: %v", err)
+		}
+	}
+
+	if got := authorization.Load(); got != "Bearer service-token" {
+		t.Errorf("Authorization = %v, want the service token", got)
+	}
+	if got := mints.Load(); got != 1 {
+		t.Errorf("service tokens minted = %d, want 1", got)
+	}
+
+	if _, ok := atpClient.RateLimit("app.bsky.feed.getFeedSkeleton"); ok {
+		t.Error("budget of the feed generator was recorded for the PDS")
+	}
+
+	// with fail fast, a budget wrongly held for the PDS would make this fail
+	if _, err = atpClient.Post(&bsky.FeedPost{Text: "hello", CreatedAt: time.Now().Format(time.RFC3339)}); err != nil {
+		t.Fatalf("post after using the service client: %v", err)
+	}
+	if got := limiter.Available(WriteCreate); got != 9 {
+		t.Errorf("available creates = %d, want 9", got)
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/suvpen/suvatp/atperr"
+	"github.com/suvpen/suvatp/oauth"
+)
+
+const (
+	deleteSessionNSID = "com.atproto.server.deleteSession"
+
+	AccountStatusDeactivated = "deactivated"
+	AccountStatusTakendown   = "takendown"
+	AccountStatusSuspended   = "suspended"
+)
+
+var ErrLoggedOut = errors.New("session has been logged out")
+
+type SessionInfo struct {
+	Did             string
+	Handle          string
+	Email           string
+	EmailConfirmed  bool
+	EmailAuthFactor bool
+	// Active is false when the account is deactivated, taken down or suspended;
+	// Status then tells which, if the PDS says.
+	Active bool
+	Status string
+}
+
+func (atpClient *ATPClient) GetSession() (*SessionInfo, error) {
+	return atpClient.GetSessionContext(context.Background())
+}
+
+func (atpClient *ATPClient) GetSessionContext(ctx context.Context) (*SessionInfo, error) {
+	var resp *atproto.ServerGetSession_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.ServerGetSession(ctx, atpClient.Client)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting session of %s: %w", atpClient.Did, err)
+	}
+
+	session := &SessionInfo{
+		Did:    resp.Did,
+		Handle: resp.Handle,
+		// PDSes that predate account status only serve active accounts
+		Active: resp.Active == nil || *resp.Active,
+	}
+	if resp.Email != nil {
+		session.Email = *resp.Email
+	}
+	if resp.EmailConfirmed != nil {
+		session.EmailConfirmed = *resp.EmailConfirmed
+	}
+	if resp.EmailAuthFactor != nil {
+		session.EmailAuthFactor = *resp.EmailAuthFactor
+	}
+	if resp.Status != nil {
+		session.Status = *resp.Status
+	}
+
+	return session, nil
+}
+
+func (atpClient *ATPClient) DeleteSession() error {
+	return atpClient.DeleteSessionContext(context.Background())
+}
+
+// DeleteSessionContext revokes the refresh JWT on the server. The access JWT stays
+// valid until it expires, but can no longer be renewed.
+func (atpClient *ATPClient) DeleteSessionContext(ctx context.Context) error {
+	atpClient.mu.Lock()
+	defer atpClient.mu.Unlock()
+
+	if atpClient.Client.Auth == nil || atpClient.Client.Auth.RefreshJwt == "" {
+		return fmt.Errorf("error deleting session of %s: %w", atpClient.Did, ErrLoggedOut)
+	}
+
+	if atpClient.IsOAuth() {
+		if err := atpClient.revokeOAuth(ctx); err != nil {
+			return fmt.Errorf("error deleting session of %s: %w", atpClient.Did, err)
+		}
+
+		return nil
+	}
+
+	refreshClient := *atpClient.Client
+	refreshClient.Auth = &xrpc.AuthInfo{AccessJwt: atpClient.Client.Auth.RefreshJwt}
+
+	if err := atproto.ServerDeleteSession(ctx, &refreshClient); err != nil {
+		return fmt.Errorf("error deleting session of %s: %w", atpClient.Did, atperr.FromError(err, deleteSessionNSID))
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) Logout() error {
+	return atpClient.LogoutContext(context.Background())
+}
+
+// LogoutContext revokes the session, removes it from the session store and clears
+// the tokens held by atpClient. A refresh JWT that had already expired or been
+// revoked does not prevent the stored session from being removed.
+func (atpClient *ATPClient) LogoutContext(ctx context.Context) error {
+	err := atpClient.DeleteSessionContext(ctx)
+
+	var oauthErr *oauth.Error
+	if err != nil && !(atperr.IsTokenExpiredError(err) || atperr.IsTokenRevokedError(err) ||
+		errors.Is(err, ErrLoggedOut) || (errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant")) {
+		return err
+	}
+
+	atpClient.mu.Lock()
+	defer atpClient.mu.Unlock()
+
+	if err = atpClient.store.Delete(atpClient.Config.ATProtoEndpoint, atpClient.Did); err != nil {
+		return fmt.Errorf("error removing session of %s: %w", atpClient.Did, err)
+	}
+
+	atpClient.setAuth("", "", "", atpClient.Did)
+
+	return nil
+}
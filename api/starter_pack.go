@@ -0,0 +1,279 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/suvpen/suvatp/util"
+	"iter"
+	"time"
+)
+
+// maxStarterPacksPerRequest is the most packs app.bsky.graph.getStarterPacks accepts.
+const maxStarterPacksPerRequest = 25
+
+var (
+	ErrStarterPackListRequired = errors.New("starter pack needs a list")
+	ErrNotStarterPack          = errors.New("record is not a starter pack")
+)
+
+// StarterPackUpdate holds the changes UpdateStarterPack makes to a starter pack;
+// nil fields are left as they are. A non-nil empty Feeds removes all feeds.
+type StarterPackUpdate struct {
+	Name        *string
+	Description *string
+	List        *string
+	Feeds       []string
+}
+
+func starterPackFeeds(feedUris []string) []*bsky.GraphStarterpack_FeedItem {
+	if len(feedUris) == 0 {
+		return nil
+	}
+
+	feeds := make([]*bsky.GraphStarterpack_FeedItem, 0, len(feedUris))
+	for _, feedUri := range feedUris {
+		feeds = append(feeds, &bsky.GraphStarterpack_FeedItem{Uri: feedUri})
+	}
+
+	return feeds
+}
+
+func (atpClient *ATPClient) CreateStarterPack(
+	name, description, listUri string, feedUris []string) (*atproto.RepoCreateRecord_Output, error) {
+	return atpClient.CreateStarterPackContext(context.Background(), name, description, listUri, feedUris)
+}
+
+// CreateStarterPackContext creates a starter pack recommending the accounts of the
+// curation list at listUri and the custom feeds at feedUris.
+func (atpClient *ATPClient) CreateStarterPackContext(
+	ctx context.Context, name, description, listUri string, feedUris []string) (*atproto.RepoCreateRecord_Output, error) {
+	if listUri == "" {
+		return nil, fmt.Errorf("error creating starter pack %s: %w", name, ErrStarterPackListRequired)
+	}
+
+	starterPack := &bsky.GraphStarterpack{
+		LexiconTypeID: GraphStarterPackLexicon,
+		CreatedAt:     time.Now().Local().Format(time.RFC3339),
+		Name:          name,
+		List:          listUri,
+		Feeds:         starterPackFeeds(feedUris),
+	}
+	if description != "" {
+		starterPack.Description = &description
+	}
+
+	var resp *atproto.RepoCreateRecord_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: GraphStarterPackLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Record:     &lexutil.LexiconTypeDecoder{Val: starterPack},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating starter pack %s: %w", name, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) UpdateStarterPack(starterPackUri string, update *StarterPackUpdate) (*atproto.RepoPutRecord_Output, error) {
+	return atpClient.UpdateStarterPackContext(context.Background(), starterPackUri, update)
+}
+
+// UpdateStarterPackContext rewrites the starter pack record with the changes of
+// update. The write fails if the starter pack was changed in the meantime.
+func (atpClient *ATPClient) UpdateStarterPackContext(
+	ctx context.Context, starterPackUri string, update *StarterPackUpdate) (*atproto.RepoPutRecord_Output, error) {
+	if update == nil {
+		update = &StarterPackUpdate{}
+	}
+
+	rKey, err := atpClient.ownRecordKey(starterPackUri, GraphStarterPackLexicon)
+	if err != nil {
+		return nil, fmt.Errorf("error updating starter pack %s: %w", starterPackUri, err)
+	}
+
+	var record *atproto.RepoGetRecord_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		record, err = atproto.RepoGetRecord(
+			ctx, atpClient.Client, "", GraphStarterPackLexicon, atpClient.Client.Auth.Did, rKey)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error updating starter pack %s: %w", starterPackUri, err)
+	}
+
+	starterPack, ok := record.Value.Val.(*bsky.GraphStarterpack)
+	if !ok {
+		return nil, fmt.Errorf("error updating starter pack %s: unexpected record type %T", starterPackUri, record.Value.Val)
+	}
+
+	if update.Name != nil {
+		starterPack.Name = *update.Name
+	}
+	if update.Description != nil {
+		starterPack.Description = update.Description
+		if *update.Description == "" {
+			starterPack.Description = nil
+		}
+		starterPack.DescriptionFacets = nil
+	}
+	if update.List != nil {
+		if *update.List == "" {
+			return nil, fmt.Errorf("error updating starter pack %s: %w", starterPackUri, ErrStarterPackListRequired)
+		}
+
+		starterPack.List = *update.List
+	}
+	if update.Feeds != nil {
+		starterPack.Feeds = starterPackFeeds(update.Feeds)
+	}
+
+	var resp *atproto.RepoPutRecord_Output
+	err = atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoPutRecord(ctx, atpClient.Client, &atproto.RepoPutRecord_Input{
+			Collection: GraphStarterPackLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Rkey:       rKey,
+			Record:     &lexutil.LexiconTypeDecoder{Val: starterPack},
+			SwapRecord: record.Cid,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error updating starter pack %s: %w", starterPackUri, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) DeleteStarterPack(starterPackUri string) error {
+	return atpClient.DeleteStarterPackContext(context.Background(), starterPackUri)
+}
+
+// DeleteStarterPackContext deletes the starter pack record. Its list is kept; delete
+// it with DeleteListContext if it is not used elsewhere.
+func (atpClient *ATPClient) DeleteStarterPackContext(ctx context.Context, starterPackUri string) error {
+	rKey, err := atpClient.ownRecordKey(starterPackUri, GraphStarterPackLexicon)
+	if err != nil {
+		return fmt.Errorf("error deleting starter pack %s: %w", starterPackUri, err)
+	}
+
+	err = atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+			Collection: GraphStarterPackLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Rkey:       rKey,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting starter pack %s: %w", starterPackUri, err)
+	}
+
+	return nil
+}
+
+func (atpClient *ATPClient) GetStarterPack(starterPackUri string) (*bsky.GraphDefs_StarterPackView, error) {
+	return atpClient.GetStarterPackContext(context.Background(), starterPackUri)
+}
+
+func (atpClient *ATPClient) GetStarterPackContext(ctx context.Context, starterPackUri string) (*bsky.GraphDefs_StarterPackView, error) {
+	var resp *bsky.GraphGetStarterPack_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.GraphGetStarterPack(ctx, atpClient.Client, starterPackUri)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting starter pack %s: %w", starterPackUri, err)
+	}
+
+	return resp.StarterPack, nil
+}
+
+func (atpClient *ATPClient) GetStarterPacks(starterPackUris []string) ([]*bsky.GraphDefs_StarterPackViewBasic, error) {
+	return atpClient.GetStarterPacksContext(context.Background(), starterPackUris)
+}
+
+// GetStarterPacksContext returns the basic views of starter packs, splitting them
+// into as many requests as needed. Packs that no longer exist are left out.
+func (atpClient *ATPClient) GetStarterPacksContext(
+	ctx context.Context, starterPackUris []string) ([]*bsky.GraphDefs_StarterPackViewBasic, error) {
+	starterPacks := make([]*bsky.GraphDefs_StarterPackViewBasic, 0, len(starterPackUris))
+
+	for start := 0; start < len(starterPackUris); start += maxStarterPacksPerRequest {
+		batch := starterPackUris[start:min(start+maxStarterPacksPerRequest, len(starterPackUris))]
+
+		var resp *bsky.GraphGetStarterPacks_Output
+		err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+			resp, err = bsky.GraphGetStarterPacks(ctx, atpClient.Client, batch)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting starter packs: %w", err)
+		}
+
+		starterPacks = append(starterPacks, resp.StarterPacks...)
+	}
+
+	return starterPacks, nil
+}
+
+func (atpClient *ATPClient) GetActorStarterPacks(
+	didOrHandle, cursor string, limit int64) (*bsky.GraphGetActorStarterPacks_Output, error) {
+	return atpClient.GetActorStarterPacksContext(context.Background(), didOrHandle, cursor, limit)
+}
+
+// GetActorStarterPacksContext returns the starter packs created by an actor.
+func (atpClient *ATPClient) GetActorStarterPacksContext(
+	ctx context.Context, didOrHandle, cursor string, limit int64) (*bsky.GraphGetActorStarterPacks_Output, error) {
+	var resp *bsky.GraphGetActorStarterPacks_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.GraphGetActorStarterPacks(ctx, atpClient.Client, didOrHandle, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting starter packs of %s: %w", didOrHandle, err)
+	}
+
+	return resp, nil
+}
+
+func (atpClient *ATPClient) GetActorStarterPacksIter(
+	ctx context.Context, didOrHandle string, opts *PageOptions) iter.Seq2[*bsky.GraphDefs_StarterPackViewBasic, error] {
+	return paginate(ctx, opts,
+		func(ctx context.Context, cursor string, limit int64) ([]*bsky.GraphDefs_StarterPackViewBasic, *string, error) {
+			resp, err := atpClient.GetActorStarterPacksContext(ctx, didOrHandle, cursor, limit)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return resp.StarterPacks, resp.Cursor, nil
+		})
+}
+
+// StarterPackShareURL returns the bsky.app link of a starter pack, using handle in
+// place of the creator's DID when it is given. URIs of other records are refused
+// with ErrNotStarterPack.
+func StarterPackShareURL(starterPackUri, handle string) (string, error) {
+	starterPackRecord, err := util.DecodeGraphRecord(starterPackUri)
+	if err != nil {
+		return "", err
+	}
+
+	if starterPackRecord.Schema != GraphStarterPackLexicon {
+		return "", fmt.Errorf("%w: %s", ErrNotStarterPack, starterPackUri)
+	}
+
+	didOrHandle := starterPackRecord.Did
+	if handle != "" {
+		didOrHandle = handle
+	}
+
+	return util.CreateBskyStarterPackURL(didOrHandle, starterPackRecord.RecordKey), nil
+}
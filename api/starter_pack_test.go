@@ -0,0 +1,50 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStarterPackShareURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		handle  string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "creator DID",
+			uri:  "at://did:plc:testaccount/app.bsky.graph.starterpack/3kstarter",
+			want: "https://bsky.app/starter-pack/did:plc:testaccount/3kstarter",
+		},
+		{
+			name:   "creator handle",
+			uri:    "at://did:plc:testaccount/app.bsky.graph.starterpack/3kstarter",
+			handle: "test.example.com",
+			want:   "https://bsky.app/starter-pack/test.example.com/3kstarter",
+		},
+		{
+			name:    "list",
+			uri:     "at://did:plc:testaccount/app.bsky.graph.list/3klist",
+			wantErr: ErrNotStarterPack,
+		},
+		{
+			name:    "follow",
+			uri:     "at://did:plc:testaccount/app.bsky.graph.follow/3kfollow",
+			wantErr: ErrNotStarterPack,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := StarterPackShareURL(test.uri, test.handle)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("url = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
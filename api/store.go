@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore persists serialized ATPClient sessions keyed by endpoint and DID.
+// Load returns ErrSessionNotFound when nothing has been saved for the key yet.
+type SessionStore interface {
+	Load(endpoint, did string) ([]byte, error)
+	Save(endpoint, did string, data []byte) error
+	Delete(endpoint, did string) error
+}
+
+// FileSessionStore keeps each session in its own file. The files hold tokens and
+// app passwords, so they are only readable by their owner unless Perm says otherwise.
+type FileSessionStore struct {
+	Dir  string
+	Perm os.FileMode
+}
+
+func NewFileSessionStore(dir string) *FileSessionStore {
+	return &FileSessionStore{Dir: dir, Perm: 0600}
+}
+
+// DefaultSessionStore keeps sessions in ATPDir under the working directory.
+func DefaultSessionStore() SessionStore {
+	return NewFileSessionStore(ATPDir)
+}
+
+func (store *FileSessionStore) path(endpoint, did string) string {
+	atpName := endpoint
+	if endpointUrl, err := url.Parse(endpoint); err == nil && endpointUrl.Host != "" {
+		atpName = endpointUrl.Host
+	}
+	atpName = strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(atpName)
+	didFileName := strings.ReplaceAll(strings.Replace(did, "did:plc:", "", 1), ":", "_")
+
+	return filepath.Join(store.Dir, fmt.Sprintf(ATPClientAuthFileName, atpName, didFileName))
+}
+
+func (store *FileSessionStore) Load(endpoint, did string) ([]byte, error) {
+	sessionPath := store.path(endpoint, did)
+
+	data, err := os.ReadFile(sessionPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrSessionNotFound
+		}
+
+		return nil, fmt.Errorf("error reading %s: %w", sessionPath, err)
+	}
+
+	if len(data) == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	return data, nil
+}
+
+func (store *FileSessionStore) Save(endpoint, did string, data []byte) error {
+	if err := os.MkdirAll(store.Dir, 0700); err != nil {
+		return fmt.Errorf("error creating %s: %w", store.Dir, err)
+	}
+
+	sessionPath := store.path(endpoint, did)
+	if err := os.WriteFile(sessionPath, data, store.Perm); err != nil {
+		return fmt.Errorf("error writing %s: %w", sessionPath, err)
+	}
+
+	// WriteFile keeps the mode of a file that already exists
+	if err := os.Chmod(sessionPath, store.Perm); err != nil {
+		return fmt.Errorf("error changing mode of %s: %w", sessionPath, err)
+	}
+
+	return nil
+}
+
+func (store *FileSessionStore) Delete(endpoint, did string) error {
+	sessionPath := store.path(endpoint, did)
+	if err := os.Remove(sessionPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error deleting %s: %w", sessionPath, err)
+	}
+
+	return nil
+}
+
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string][]byte
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string][]byte)}
+}
+
+func (store *MemorySessionStore) Load(endpoint, did string) ([]byte, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	data, ok := store.sessions[endpoint+"|"+did]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+func (store *MemorySessionStore) Save(endpoint, did string, data []byte) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.sessions[endpoint+"|"+did] = append([]byte(nil), data...)
+
+	return nil
+}
+
+func (store *MemorySessionStore) Delete(endpoint, did string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.sessions, endpoint+"|"+did)
+
+	return nil
+}
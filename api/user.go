@@ -6,35 +6,34 @@ import (
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/api/bsky"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
-	"github.com/suvpen/suvatp/atperr"
+	"github.com/suvpen/suvatp/identity"
 	"github.com/suvpen/suvatp/util"
-	"strings"
 	"time"
 )
 
 func (atpClient *ATPClient) GetPreferences() (*bsky.ActorGetPreferences_Output, error) {
-	resp, err := bsky.ActorGetPreferences(context.TODO(), atpClient.Client)
+	return atpClient.GetPreferencesContext(context.Background())
+}
+
+func (atpClient *ATPClient) GetPreferencesContext(ctx context.Context) (*bsky.ActorGetPreferences_Output, error) {
+	var resp *bsky.ActorGetPreferences_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = bsky.ActorGetPreferences(ctx, atpClient.Client)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetPreferences()
-			} else {
-				return nil, fmt.Errorf("error getting preferences: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting preferences: %w", err)
-		}
+		return nil, fmt.Errorf("error getting preferences: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) SubscribeLabeler(did string) error {
-	lastPrefs, err := atpClient.GetPreferences()
+	return atpClient.SubscribeLabelerContext(context.Background(), did)
+}
+
+func (atpClient *ATPClient) SubscribeLabelerContext(ctx context.Context, did string) error {
+	lastPrefs, err := atpClient.GetPreferencesContext(ctx)
 	if err != nil {
 		return fmt.Errorf("error subscribing preferences: %w", err)
 	}
@@ -53,189 +52,189 @@ func (atpClient *ATPClient) SubscribeLabeler(did string) error {
 		},
 	})
 
-	err = bsky.ActorPutPreferences(context.TODO(), atpClient.Client, input)
+	err = atpClient.invoke(ctx, func(ctx context.Context) error {
+		return bsky.ActorPutPreferences(ctx, atpClient.Client, input)
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.SubscribeLabeler(did)
-			} else {
-				return fmt.Errorf("error subscribing preferences: %w", err)
-			}
-		} else {
-			return fmt.Errorf("error subscribing preferences: %w", err)
-		}
+		return fmt.Errorf("error subscribing preferences: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return nil
 }
 
 func (atpClient *ATPClient) LikeLabeler(cid, did string) (*atproto.RepoCreateRecord_Output, error) {
-	repostResp, err := atproto.RepoCreateRecord(context.TODO(), atpClient.Client, &atproto.RepoCreateRecord_Input{
-		Collection: atpClient.Config.LikesCollection,
-		Repo:       atpClient.Client.Auth.Did,
-		Record: &lexutil.LexiconTypeDecoder{
-			Val: &bsky.FeedLike{
-				CreatedAt: time.Now().Local().Format(time.RFC3339),
-				Subject: &atproto.RepoStrongRef{
-					Cid: cid,
-					Uri: fmt.Sprintf("at://%s/%s/self", did, atpClient.Config.LabelerService),
+	return atpClient.LikeLabelerContext(context.Background(), cid, did)
+}
+
+func (atpClient *ATPClient) LikeLabelerContext(ctx context.Context, cid, did string) (*atproto.RepoCreateRecord_Output, error) {
+	var repostResp *atproto.RepoCreateRecord_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		repostResp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: atpClient.Config.LikesCollection,
+			Repo:       atpClient.Client.Auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{
+				Val: &bsky.FeedLike{
+					CreatedAt: time.Now().Local().Format(time.RFC3339),
+					Subject: &atproto.RepoStrongRef{
+						Cid: cid,
+						Uri: fmt.Sprintf("at://%s/%s/self", did, atpClient.Config.LabelerService),
+					},
 				},
 			},
-		},
+		})
+		return err
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.LikeLabeler(cid, did)
-			} else {
-				return nil, fmt.Errorf("error liking labeler: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error liking labeler: %w", err)
-		}
+		return nil, fmt.Errorf("error liking labeler: %w", err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return repostResp, nil
 }
 
 func (atpClient *ATPClient) ResolveHandle(handle string) (string, error) {
-	resp, err := atproto.IdentityResolveHandle(context.TODO(), atpClient.Client, handle)
+	return atpClient.ResolveHandleContext(context.Background(), handle)
+}
+
+func (atpClient *ATPClient) ResolveHandleContext(ctx context.Context, handle string) (string, error) {
+	var resp *atproto.IdentityResolveHandle_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.IdentityResolveHandle(ctx, atpClient.Client, handle)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.ResolveHandle(handle)
-			} else {
-				return "", fmt.Errorf("error resolving %s handle: %w", handle, err)
-			}
-		} else {
-			return "", fmt.Errorf("error resolving %s handle: %w", handle, err)
-		}
+		return "", fmt.Errorf("error resolving %s handle: %w", handle, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp.Did, nil
 }
 
+func (atpClient *ATPClient) ResolveDid(did string) (*DidDoc, error) {
+	return atpClient.ResolveDidContext(context.Background(), did)
+}
+
+func (atpClient *ATPClient) ResolveDidContext(ctx context.Context, did string) (*DidDoc, error) {
+	return atpClient.resolver.ResolveDid(ctx, did)
+}
+
+// VerifyHandle resolves handle locally (DNS or HTTPS) instead of asking the PDS, and
+// checks that the resulting DID document claims the handle back.
+func (atpClient *ATPClient) VerifyHandle(handle string) (string, error) {
+	return atpClient.VerifyHandleContext(context.Background(), handle)
+}
+
+func (atpClient *ATPClient) VerifyHandleContext(ctx context.Context, handle string) (string, error) {
+	did, _, err := atpClient.resolver.VerifyHandle(ctx, handle)
+	return did, err
+}
+
+// VerifyDid returns the handle of did once it has been verified in both directions.
+func (atpClient *ATPClient) VerifyDid(did string) (string, error) {
+	return atpClient.VerifyDidContext(context.Background(), did)
+}
+
+func (atpClient *ATPClient) VerifyDidContext(ctx context.Context, did string) (string, error) {
+	handle, _, err := atpClient.resolver.VerifyDid(ctx, did)
+	return handle, err
+}
+
 func (atpClient *ATPClient) GetProfile(didOrHandle string) (*bsky.ActorDefs_ProfileViewDetailed, error) {
-	profile, err := bsky.ActorGetProfile(context.TODO(), atpClient.Client, didOrHandle)
+	return atpClient.GetProfileContext(context.Background(), didOrHandle)
+}
+
+func (atpClient *ATPClient) GetProfileContext(ctx context.Context, didOrHandle string) (*bsky.ActorDefs_ProfileViewDetailed, error) {
+	var profile *bsky.ActorDefs_ProfileViewDetailed
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		profile, err = bsky.ActorGetProfile(ctx, atpClient.Client, didOrHandle)
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetProfile(didOrHandle)
-			} else {
-				return nil, fmt.Errorf("error getting %s profile: %w", didOrHandle, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting %s profile: %w", didOrHandle, err)
-		}
+		return nil, fmt.Errorf("error getting %s profile: %w", didOrHandle, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return profile, nil
 }
 
 func (atpClient *ATPClient) SearchActors(q, cursor string, limit int64) (*bsky.ActorSearchActors_Output, error) {
-	profile, err := bsky.ActorSearchActors(context.TODO(), atpClient.Client, cursor, limit, q, "")
+	return atpClient.SearchActorsContext(context.Background(), q, cursor, limit)
+}
+
+func (atpClient *ATPClient) SearchActorsContext(ctx context.Context, q, cursor string, limit int64) (*bsky.ActorSearchActors_Output, error) {
+	var profile *bsky.ActorSearchActors_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		profile, err = bsky.ActorSearchActors(ctx, atpClient.Client, cursor, limit, q, "")
+		return err
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.SearchActors(q, cursor, limit)
-			} else {
-				return nil, fmt.Errorf("error searching actors with q=%s: %w", q, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error searching actors with q=%s: %w", q, err)
-		}
+		return nil, fmt.Errorf("error searching actors with q=%s: %w", q, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return profile, nil
 }
 
 func (atpClient *ATPClient) GetFollows(cursor string) (*bsky.GraphGetFollows_Output, error) {
-	follows, err := bsky.GraphGetFollows(context.TODO(), atpClient.Client, atpClient.Client.Auth.Did, cursor, 100)
-	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.GetFollows(cursor)
-			} else {
-				return nil, fmt.Errorf("error getting follows: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("error getting follows: %w", err)
-		}
-	}
+	return atpClient.GetFollowsContext(context.Background(), cursor)
+}
 
-	atpClient.RetryCount = 0
+// GetFollowsContext returns the follows of the authenticated account; use
+// GetActorFollowsContext for other accounts or another page size.
+func (atpClient *ATPClient) GetFollowsContext(ctx context.Context, cursor string) (*bsky.GraphGetFollows_Output, error) {
+	atpClient.mu.RLock()
+	did := atpClient.Client.Auth.Did
+	atpClient.mu.RUnlock()
 
-	return follows, nil
+	return atpClient.GetActorFollowsContext(ctx, did, cursor, DefaultPageSize)
 }
 
 func (atpClient *ATPClient) FollowDid(did string) (*atproto.RepoCreateRecord_Output, error) {
-	if !strings.Contains(did, "did:plc:") {
-		return nil, fmt.Errorf("error following DID %s: DID must contain 'did:plc:'", did)
+	return atpClient.FollowDidContext(context.Background(), did)
+}
+
+func (atpClient *ATPClient) FollowDidContext(ctx context.Context, did string) (*atproto.RepoCreateRecord_Output, error) {
+	if err := identity.ValidateDid(did); err != nil {
+		return nil, fmt.Errorf("error following DID %s: %w", did, err)
 	}
 
-	resp, err := atproto.RepoCreateRecord(context.TODO(), atpClient.Client, &atproto.RepoCreateRecord_Input{
-		Collection: atpClient.Config.GraphFollowLexicon,
-		Repo:       atpClient.Client.Auth.Did,
-		Record: &lexutil.LexiconTypeDecoder{
-			Val: &bsky.GraphFollow{
-				LexiconTypeID: atpClient.Config.GraphFollowLexicon,
-				CreatedAt:     time.Now().Local().Format(time.RFC3339),
-				Subject:       did,
+	var resp *atproto.RepoCreateRecord_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: atpClient.Config.GraphFollowLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{
+				Val: &bsky.GraphFollow{
+					LexiconTypeID: atpClient.Config.GraphFollowLexicon,
+					CreatedAt:     time.Now().Local().Format(time.RFC3339),
+					Subject:       did,
+				},
 			},
-		},
+		})
+		return err
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.FollowDid(did)
-			} else {
-				return nil, fmt.Errorf("error following DID %s: %w", did, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error following DID %s: %w", did, err)
-		}
+		return nil, fmt.Errorf("error following DID %s: %w", did, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) FollowHandle(handle string) (*atproto.RepoCreateRecord_Output, error) {
-	did, err := atpClient.ResolveHandle(handle)
+	return atpClient.FollowHandleContext(context.Background(), handle)
+}
+
+func (atpClient *ATPClient) FollowHandleContext(ctx context.Context, handle string) (*atproto.RepoCreateRecord_Output, error) {
+	did, err := atpClient.ResolveHandleContext(ctx, handle)
 	if err != nil {
 		return nil, fmt.Errorf("error following handle %s: %w", handle, err)
 	}
 
-	return atpClient.FollowDid(did)
+	return atpClient.FollowDidContext(ctx, did)
 }
 
 func (atpClient *ATPClient) Unfollow(didOrHandle string) error {
-	profile, err := atpClient.GetProfile(didOrHandle)
+	return atpClient.UnfollowContext(context.Background(), didOrHandle)
+}
+
+func (atpClient *ATPClient) UnfollowContext(ctx context.Context, didOrHandle string) error {
+	profile, err := atpClient.GetProfileContext(ctx, didOrHandle)
 	if err != nil {
 		return fmt.Errorf("error unfollowing %s: %w", didOrHandle, err)
 	}
@@ -249,102 +248,94 @@ func (atpClient *ATPClient) Unfollow(didOrHandle string) error {
 		return fmt.Errorf("error unfollowing DID %s: %w", didOrHandle, err)
 	}
 
-	err = atproto.RepoDeleteRecord(context.TODO(), atpClient.Client, &atproto.RepoDeleteRecord_Input{
-		Repo:       atpClient.Client.Auth.Did,
-		Collection: folRecord.Schema,
-		Rkey:       folRecord.RecordKey,
+	err = atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+			Repo:       atpClient.Client.Auth.Did,
+			Collection: folRecord.Schema,
+			Rkey:       folRecord.RecordKey,
+		})
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.Unfollow(didOrHandle)
-			} else {
-				return fmt.Errorf("error unfollowing DID %s: %w", didOrHandle, err)
-			}
-		} else {
-			return fmt.Errorf("error unfollowing DID %s: %w", didOrHandle, err)
-		}
+		return fmt.Errorf("error unfollowing DID %s: %w", didOrHandle, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return nil
 }
 
 func (atpClient *ATPClient) MuteDid(did string) error {
-	err := bsky.GraphMuteActor(context.TODO(), atpClient.Client, &bsky.GraphMuteActor_Input{Actor: did})
+	return atpClient.MuteDidContext(context.Background(), did)
+}
+
+func (atpClient *ATPClient) MuteDidContext(ctx context.Context, did string) error {
+	err := atpClient.invoke(ctx, func(ctx context.Context) error {
+		return bsky.GraphMuteActor(ctx, atpClient.Client, &bsky.GraphMuteActor_Input{Actor: did})
+	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.Unfollow(did)
-			} else {
-				return fmt.Errorf("error muting DID %s: %w", did, err)
-			}
-		} else {
-			return fmt.Errorf("error muting DID %s: %w", did, err)
-		}
+		return fmt.Errorf("error muting DID %s: %w", did, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return nil
 }
 
 func (atpClient *ATPClient) MuteHandle(handle string) error {
-	did, err := atpClient.ResolveHandle(handle)
+	return atpClient.MuteHandleContext(context.Background(), handle)
+}
+
+func (atpClient *ATPClient) MuteHandleContext(ctx context.Context, handle string) error {
+	did, err := atpClient.ResolveHandleContext(ctx, handle)
 	if err != nil {
 		return fmt.Errorf("error muting handle %s: %w", handle, err)
 	}
 
-	return atpClient.MuteDid(did)
+	return atpClient.MuteDidContext(ctx, did)
 }
 
 func (atpClient *ATPClient) BlockDid(did string) (*atproto.RepoCreateRecord_Output, error) {
-	resp, err := atproto.RepoCreateRecord(context.TODO(), atpClient.Client, &atproto.RepoCreateRecord_Input{
-		Collection: atpClient.Config.GraphBlockLexicon,
-		Repo:       atpClient.Client.Auth.Did,
-		Record: &lexutil.LexiconTypeDecoder{
-			Val: &bsky.GraphBlock{
-				LexiconTypeID: atpClient.Config.GraphBlockLexicon,
-				CreatedAt:     time.Now().Local().Format(time.RFC3339),
-				Subject:       did,
+	return atpClient.BlockDidContext(context.Background(), did)
+}
+
+func (atpClient *ATPClient) BlockDidContext(ctx context.Context, did string) (*atproto.RepoCreateRecord_Output, error) {
+	var resp *atproto.RepoCreateRecord_Output
+	err := atpClient.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = atproto.RepoCreateRecord(ctx, atpClient.Client, &atproto.RepoCreateRecord_Input{
+			Collection: atpClient.Config.GraphBlockLexicon,
+			Repo:       atpClient.Client.Auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{
+				Val: &bsky.GraphBlock{
+					LexiconTypeID: atpClient.Config.GraphBlockLexicon,
+					CreatedAt:     time.Now().Local().Format(time.RFC3339),
+					Subject:       did,
+				},
 			},
-		},
+		})
+		return err
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.BlockDid(did)
-			} else {
-				return nil, fmt.Errorf("error blocking DID %s: %w", did, err)
-			}
-		} else {
-			return nil, fmt.Errorf("error blocking DID %s: %w", did, err)
-		}
+		return nil, fmt.Errorf("error blocking DID %s: %w", did, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return resp, nil
 }
 
 func (atpClient *ATPClient) BlockHandle(handle string) (*atproto.RepoCreateRecord_Output, error) {
-	did, err := atpClient.ResolveHandle(handle)
+	return atpClient.BlockHandleContext(context.Background(), handle)
+}
+
+func (atpClient *ATPClient) BlockHandleContext(ctx context.Context, handle string) (*atproto.RepoCreateRecord_Output, error) {
+	did, err := atpClient.ResolveHandleContext(ctx, handle)
 	if err != nil {
 		return nil, fmt.Errorf("error blocking handle %s: %w", handle, err)
 	}
 
-	return atpClient.BlockDid(did)
+	return atpClient.BlockDidContext(ctx, did)
 }
 
 func (atpClient *ATPClient) Unblock(didOrHandle string) error {
-	profile, err := atpClient.GetProfile(didOrHandle)
+	return atpClient.UnblockContext(context.Background(), didOrHandle)
+}
+
+func (atpClient *ATPClient) UnblockContext(ctx context.Context, didOrHandle string) error {
+	profile, err := atpClient.GetProfileContext(ctx, didOrHandle)
 	if err != nil {
 		return fmt.Errorf("error unblocking %s: %w", didOrHandle, err)
 	}
@@ -358,26 +349,16 @@ func (atpClient *ATPClient) Unblock(didOrHandle string) error {
 		return fmt.Errorf("error unblocking DID %s: %w", didOrHandle, err)
 	}
 
-	err = atproto.RepoDeleteRecord(context.TODO(), atpClient.Client, &atproto.RepoDeleteRecord_Input{
-		Repo:       atpClient.Client.Auth.Did,
-		Collection: blockRecord.Schema,
-		Rkey:       blockRecord.RecordKey,
+	err = atpClient.invoke(ctx, func(ctx context.Context) error {
+		return atproto.RepoDeleteRecord(ctx, atpClient.Client, &atproto.RepoDeleteRecord_Input{
+			Repo:       atpClient.Client.Auth.Did,
+			Collection: blockRecord.Schema,
+			Rkey:       blockRecord.RecordKey,
+		})
 	})
 	if err != nil {
-		if atperr.IsUpstreamFailureError(err) || atperr.IsUpstreamTimeoutError(err) || atperr.IsInternalServerError(err) {
-			if atpClient.RetryCount != atpClient.Config.Retries {
-				atpClient.RetryCount++
-				time.Sleep(time.Second * 3)
-				return atpClient.Unblock(didOrHandle)
-			} else {
-				return fmt.Errorf("error unblocking %s: %w", didOrHandle, err)
-			}
-		} else {
-			return fmt.Errorf("error unblocking %s: %w", didOrHandle, err)
-		}
+		return fmt.Errorf("error unblocking %s: %w", didOrHandle, err)
 	}
 
-	atpClient.RetryCount = 0
-
 	return nil
 }
@@ -0,0 +1,101 @@
+package atperr
+
+import (
+	"errors"
+	"github.com/bluesky-social/indigo/xrpc"
+	"time"
+)
+
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Policy    string
+	Reset     time.Time
+}
+
+// ATPError is the structured form of an XRPC error response. Its Error text is the
+// one of the wrapped error, so existing message checks keep working.
+type ATPError struct {
+	StatusCode int
+	Name       string
+	Message    string
+	Endpoint   string
+	RateLimit  *RateLimit
+
+	Err error
+}
+
+func (e *ATPError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ATPError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes the Err* conditions usable with errors.Is.
+func (e *ATPError) Is(target error) bool {
+	condition, ok := target.(*Condition)
+	return ok && condition.matches(e)
+}
+
+func newATPError(xrpcErr *xrpc.Error, err error, endpoint string) *ATPError {
+	atpErr := &ATPError{
+		StatusCode: xrpcErr.StatusCode,
+		Endpoint:   endpoint,
+		Err:        err,
+	}
+
+	var body *xrpc.XRPCError
+	if errors.As(xrpcErr.Wrapped, &body) {
+		atpErr.Name = body.ErrStr
+		atpErr.Message = body.Message
+	}
+
+	if xrpcErr.Ratelimit != nil {
+		atpErr.RateLimit = &RateLimit{
+			Limit:     xrpcErr.Ratelimit.Limit,
+			Remaining: xrpcErr.Ratelimit.Remaining,
+			Policy:    xrpcErr.Ratelimit.Policy,
+			Reset:     xrpcErr.Ratelimit.Reset,
+		}
+	}
+
+	return atpErr
+}
+
+// FromError wraps the *xrpc.Error found in err's chain into an *ATPError tagged with
+// the endpoint NSID. Errors without an XRPC response are returned unchanged.
+func FromError(err error, endpoint string) error {
+	if err == nil {
+		return nil
+	}
+
+	var atpErr *ATPError
+	if errors.As(err, &atpErr) {
+		return err
+	}
+
+	var xrpcErr *xrpc.Error
+	if !errors.As(err, &xrpcErr) {
+		return err
+	}
+
+	return newATPError(xrpcErr, err, endpoint)
+}
+
+// AsATPError finds the *ATPError in err's chain, building one from a bare
+// *xrpc.Error if needed.
+func AsATPError(err error) (*ATPError, bool) {
+	var atpErr *ATPError
+	if errors.As(err, &atpErr) {
+		return atpErr, true
+	}
+
+	var xrpcErr *xrpc.Error
+	if errors.As(err, &xrpcErr) {
+		return newATPError(xrpcErr, err, ""), true
+	}
+
+	return nil, false
+}
@@ -1,111 +1,212 @@
 package atperr
 
-import "strings"
-
-const (
-	errorInternalServerError = "InternalServerError: Internal Server Error"
-
-	errorInvalidDidOrPassword    = "AuthenticationRequired: Invalid identifier or password"
-	errorAuthFactorTokenRequired = "AuthFactorTokenRequired: A sign in code has been sent to your email address"
-	errorTokenExpired            = "ExpiredToken: Token has expired"
-	errorTokenRevoked            = "Token has been revoked"
-
-	errorProfileNotFound         = "InvalidRequest: Profile not found"
-	errorInvalidActorDidOrHandle = "InvalidRequest: Error: actor must be a valid did or a handle"
-	errorHandleMustBeValidHandle = "InvalidRequest: Error: handle must be a valid handle"
-	errorParamMustHavePropHandle = `InvalidRequest: Error: Params must have the property "handle"`
-	errorParamMustHavePropActor  = `InvalidRequest: Error: Params must have the property "actor"`
-	errorAccountDeactivated      = "AccountDeactivated: Account is deactivated"
-	errorInvalidFollowDid        = "Record/subject must be a valid did"
-
-	errorRecipientNotFollowingYou = "InvalidRequest: recipient requires incoming messages to come from someone they follow"
-
-	errorUpstreamFailure = "UpstreamFailure: Upstream Failure"
-	errorUpstreamTimeout = "UpstreamTimeout: Upload timed out, please try again"
-
-	errorInvalidRepo          = "InvalidRequest: Error: repo must be a valid did or a handle"
-	errorCouldNotFindRepo     = "InvalidRequest: Could not find repo"
-	errorCouldNotLocateRecord = "InvalidRequest: Could not locate record"
-	errorBlobTooLarge         = "BlobTooLarge: This file is too large"
-	errorCouldNotFindBlob     = "BlobNotFound: Could not find blob"
+import (
+	"errors"
+	"fmt"
+	"github.com/bluesky-social/indigo/xrpc"
+	"strings"
 )
 
+// Condition is a sentinel for a known XRPC failure, usable with errors.Is on errors
+// returned by the api package. It matches an ATPError by error name and, when set,
+// a fragment of the message, so rewording of the rest of the message is tolerated.
+type Condition struct {
+	Name    string
+	Message string
+
+	text string
+}
+
+func (c *Condition) Error() string {
+	return c.text
+}
+
+func (c *Condition) matches(e *ATPError) bool {
+	if c.Name != "" && c.Name != e.Name {
+		return false
+	}
+
+	return c.Message == "" || strings.Contains(e.Message, c.Message)
+}
+
+func newCondition(name, message, text string) *Condition {
+	return &Condition{Name: name, Message: message, text: text}
+}
+
+var (
+	ErrInternalServerError = newCondition(
+		"InternalServerError", "", "InternalServerError: Internal Server Error")
+
+	ErrInvalidDidOrPassword = newCondition(
+		"AuthenticationRequired", "Invalid identifier or password",
+		"AuthenticationRequired: Invalid identifier or password")
+	ErrAuthFactorTokenRequired = newCondition(
+		"AuthFactorTokenRequired", "",
+		"AuthFactorTokenRequired: A sign in code has been sent to your email address")
+	ErrTokenExpired = newCondition("ExpiredToken", "", "ExpiredToken: Token has expired")
+	ErrTokenRevoked = newCondition("", "Token has been revoked", "Token has been revoked")
+
+	ErrProfileNotFound = newCondition(
+		"InvalidRequest", "Profile not found", "InvalidRequest: Profile not found")
+	ErrInvalidActorDidOrHandle = newCondition(
+		"InvalidRequest", "actor must be a valid did or a handle",
+		"InvalidRequest: Error: actor must be a valid did or a handle")
+	ErrHandleMustBeValidHandle = newCondition(
+		"InvalidRequest", "handle must be a valid handle", "InvalidRequest: Error: handle must be a valid handle")
+	ErrParamMustHavePropHandle = newCondition(
+		"InvalidRequest", `Params must have the property "handle"`,
+		`InvalidRequest: Error: Params must have the property "handle"`)
+	ErrParamMustHavePropActor = newCondition(
+		"InvalidRequest", `Params must have the property "actor"`,
+		`InvalidRequest: Error: Params must have the property "actor"`)
+	ErrAccountDeactivated = newCondition(
+		"AccountDeactivated", "", "AccountDeactivated: Account is deactivated")
+	ErrInvalidFollowDid = newCondition(
+		"", "Record/subject must be a valid did", "Record/subject must be a valid did")
+
+	ErrRecipientNotFollowingYou = newCondition(
+		"InvalidRequest", "recipient requires incoming messages to come from someone they follow",
+		"InvalidRequest: recipient requires incoming messages to come from someone they follow")
+
+	ErrRateLimitExceeded = newCondition(
+		"RateLimitExceeded", "", "RateLimitExceeded: Rate Limit Exceeded")
+
+	ErrUpstreamFailure = newCondition("UpstreamFailure", "", "UpstreamFailure: Upstream Failure")
+	ErrUpstreamTimeout = newCondition(
+		"UpstreamTimeout", "", "UpstreamTimeout: Upload timed out, please try again")
+
+	ErrInvalidRepo = newCondition(
+		"InvalidRequest", "repo must be a valid did or a handle",
+		"InvalidRequest: Error: repo must be a valid did or a handle")
+	ErrCouldNotFindRepo = newCondition(
+		"InvalidRequest", "Could not find repo", "InvalidRequest: Could not find repo")
+	ErrCouldNotLocateRecord = newCondition(
+		"InvalidRequest", "Could not locate record", "InvalidRequest: Could not locate record")
+	ErrBlobTooLarge     = newCondition("BlobTooLarge", "", "BlobTooLarge: This file is too large")
+	ErrCouldNotFindBlob = newCondition("BlobNotFound", "", "BlobNotFound: Could not find blob")
+)
+
+// is matches err against condition structurally when it carries an XRPC error, and
+// falls back to comparing the message text for errors from anywhere else.
+func is(err error, condition *Condition) bool {
+	if err == nil {
+		return false
+	}
+
+	if atpErr, ok := AsATPError(err); ok {
+		return condition.matches(atpErr)
+	}
+
+	return strings.Contains(err.Error(), condition.text)
+}
+
 func IsInternalServerError(err error) bool {
-	return strings.Contains(err.Error(), errorInternalServerError)
+	return is(err, ErrInternalServerError)
 }
 
 func IsInvalidDIDOrPasswordError(err error) bool {
-	return strings.Contains(err.Error(), errorInvalidDidOrPassword)
+	return is(err, ErrInvalidDidOrPassword)
 }
 
 func IsAuthFactorTokenRequiredError(err error) bool {
-	return strings.Contains(err.Error(), errorAuthFactorTokenRequired)
+	return is(err, ErrAuthFactorTokenRequired)
 }
 
 func IsTokenExpiredError(err error) bool {
-	return strings.Contains(err.Error(), errorTokenExpired)
+	return is(err, ErrTokenExpired)
 }
 
 func IsTokenRevokedError(err error) bool {
-	return strings.Contains(err.Error(), errorTokenRevoked)
+	return is(err, ErrTokenRevoked)
 }
 
 func IsProfileNotFoundError(err error) bool {
-	return strings.Contains(err.Error(), errorProfileNotFound)
+	return is(err, ErrProfileNotFound)
 }
 
 func IsInvalidActorDidOrHandleError(err error) bool {
-	return strings.Contains(err.Error(), errorInvalidActorDidOrHandle)
+	return is(err, ErrInvalidActorDidOrHandle)
 }
 
 func IsHandleMustBeValidHandleError(err error) bool {
-	return strings.Contains(err.Error(), errorHandleMustBeValidHandle)
+	return is(err, ErrHandleMustBeValidHandle)
 }
 
 func IsParamMustHavePropHandleError(err error) bool {
-	return strings.Contains(err.Error(), errorParamMustHavePropHandle)
+	return is(err, ErrParamMustHavePropHandle)
 }
 
 func IsParamMustHavePropActorError(err error) bool {
-	return strings.Contains(err.Error(), errorParamMustHavePropActor)
+	return is(err, ErrParamMustHavePropActor)
 }
 
 func IsAccountDeactivatedError(err error) bool {
-	return strings.Contains(err.Error(), errorAccountDeactivated)
+	return is(err, ErrAccountDeactivated)
 }
 
 func IsInvalidFollowDidError(err error) bool {
-	return strings.Contains(err.Error(), errorInvalidFollowDid)
+	return is(err, ErrInvalidFollowDid)
 }
 
 func IsRecipientNotFollowingYouError(err error) bool {
-	return strings.Contains(err.Error(), errorRecipientNotFollowingYou)
+	return is(err, ErrRecipientNotFollowingYou)
+}
+
+func IsRateLimitExceededError(err error) bool {
+	return is(err, ErrRateLimitExceeded)
 }
 
 func IsUpstreamFailureError(err error) bool {
-	return strings.Contains(err.Error(), errorUpstreamFailure)
+	return is(err, ErrUpstreamFailure)
 }
 
 func IsUpstreamTimeoutError(err error) bool {
-	return strings.Contains(err.Error(), errorUpstreamTimeout)
+	return is(err, ErrUpstreamTimeout)
 }
 
 func IsInvalidRepoError(err error) bool {
-	return strings.Contains(err.Error(), errorInvalidRepo)
+	return is(err, ErrInvalidRepo)
 }
 
 func IsCouldNotFindRepoError(err error) bool {
-	return strings.Contains(err.Error(), errorCouldNotFindRepo)
+	return is(err, ErrCouldNotFindRepo)
 }
 
 func IsCouldNotLocateRecordError(err error) bool {
-	return strings.Contains(err.Error(), errorCouldNotLocateRecord)
+	return is(err, ErrCouldNotLocateRecord)
 }
 
 func IsBlobTooLargeError(err error) bool {
-	return strings.Contains(err.Error(), errorBlobTooLarge)
+	return is(err, ErrBlobTooLarge)
 }
 
 func IsCouldNotFindBlobError(err error) bool {
-	return strings.Contains(err.Error(), errorCouldNotFindBlob)
+	return is(err, ErrCouldNotFindBlob)
+}
+
+// AuthFactorTokenRequiredError is returned when signing in needs the code the server
+// sent out of band. Prompt carries the server's message, e.g. where the code was sent.
+type AuthFactorTokenRequiredError struct {
+	Identifier string
+	Prompt     string
+	Err        error
+}
+
+func NewAuthFactorTokenRequiredError(identifier string, err error) *AuthFactorTokenRequiredError {
+	prompt := strings.TrimPrefix(ErrAuthFactorTokenRequired.text, "AuthFactorTokenRequired: ")
+
+	var xrpcErr *xrpc.XRPCError
+	if errors.As(err, &xrpcErr) && xrpcErr.Message != "" {
+		prompt = xrpcErr.Message
+	}
+
+	return &AuthFactorTokenRequiredError{Identifier: identifier, Prompt: prompt, Err: err}
+}
+
+func (e *AuthFactorTokenRequiredError) Error() string {
+	return fmt.Sprintf("auth factor token required for %s: %v", e.Identifier, e.Err)
+}
+
+func (e *AuthFactorTokenRequiredError) Unwrap() error {
+	return e.Err
 }
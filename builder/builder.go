@@ -2,15 +2,12 @@ package builder
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/api/chat"
-	lexutil "github.com/bluesky-social/indigo/lex/util"
-	"github.com/bluesky-social/indigo/xrpc"
 	"github.com/suvpen/suvatp/api"
 	"github.com/suvpen/suvatp/atperr"
 	"github.com/suvpen/suvatp/util"
@@ -42,6 +39,10 @@ type MentionInput struct {
 }
 
 func BuildPost(atpClient *api.ATPClient, postData PostData) (*bsky.FeedPost, error) {
+	return BuildPostContext(context.Background(), atpClient, postData)
+}
+
+func BuildPostContext(ctx context.Context, atpClient *api.ATPClient, postData PostData) (*bsky.FeedPost, error) {
 	var createdAtStr string
 
 	if postData.CreatedAt.IsZero() {
@@ -57,7 +58,7 @@ func BuildPost(atpClient *api.ATPClient, postData PostData) (*bsky.FeedPost, err
 
 	if postData.QuoteUrl != "" {
 		resp, err := atpClient.
-			GetPost(util.GetHandleFromURL(postData.QuoteUrl), util.GetRecordKeyFromUrlOrAtUri(postData.QuoteUrl))
+			GetPostContext(ctx, util.GetHandleFromURL(postData.QuoteUrl), util.GetRecordKeyFromUrlOrAtUri(postData.QuoteUrl))
 		if err != nil {
 			return nil, fmt.Errorf("error building post: invalid QuoteUrl record: %w", err)
 		}
@@ -77,11 +78,11 @@ func BuildPost(atpClient *api.ATPClient, postData PostData) (*bsky.FeedPost, err
 		}
 
 		if post.Embed.EmbedExternal == nil {
-			addLink(atpClient.Client, post, postData.EmbedUrl)
+			addLink(ctx, atpClient, post, postData.EmbedUrl)
 		}
 	}
 
-	injectedFacets, err := injectFacets(atpClient, post.Text, postData.MentionInput)
+	injectedFacets, err := injectFacets(ctx, atpClient, post.Text, postData.MentionInput)
 	if err != nil {
 		return nil, fmt.Errorf("error injecting facets: %w", err)
 	}
@@ -97,7 +98,7 @@ func BuildPost(atpClient *api.ATPClient, postData PostData) (*bsky.FeedPost, err
 			Images: postData.EmbedImages,
 		}
 	} else if len(postData.ImagePaths) > 0 {
-		images, err := atpClient.UploadImages(postData.ImagePaths)
+		images, err := atpClient.UploadImagesContext(ctx, postData.ImagePaths)
 		if err != nil {
 			return nil, err
 		}
@@ -117,6 +118,11 @@ func BuildPost(atpClient *api.ATPClient, postData PostData) (*bsky.FeedPost, err
 }
 
 func BuildMessage(atpClient *api.ATPClient, msgData MessageData) (*chat.ConvoSendMessage_Input, error) {
+	return BuildMessageContext(context.Background(), atpClient, msgData)
+}
+
+func BuildMessageContext(
+	ctx context.Context, atpClient *api.ATPClient, msgData MessageData) (*chat.ConvoSendMessage_Input, error) {
 	msgInput := &chat.ConvoSendMessage_Input{
 		ConvoId: msgData.ConvoId,
 		Message: &chat.ConvoDefs_MessageInput{
@@ -131,7 +137,7 @@ func BuildMessage(atpClient *api.ATPClient, msgData MessageData) (*chat.ConvoSen
 			}}
 	} else if msgData.PostUrl != "" {
 		postRecord, err := atpClient.
-			GetPost(util.GetHandleFromURL(msgData.PostUrl), util.GetRecordKeyFromUrlOrAtUri(msgData.PostUrl))
+			GetPostContext(ctx, util.GetHandleFromURL(msgData.PostUrl), util.GetRecordKeyFromUrlOrAtUri(msgData.PostUrl))
 		if err == nil {
 			msgInput.Message.Embed = &chat.ConvoDefs_MessageInput_Embed{
 				EmbedRecord: &bsky.EmbedRecord{
@@ -140,7 +146,7 @@ func BuildMessage(atpClient *api.ATPClient, msgData MessageData) (*chat.ConvoSen
 		}
 	}
 
-	injectedFacets, err := injectFacets(atpClient, msgData.Text, msgData.MentionInput)
+	injectedFacets, err := injectFacets(ctx, atpClient, msgData.Text, msgData.MentionInput)
 	if err != nil {
 		return nil, fmt.Errorf("error building message: error injecting facets: %w", err)
 	}
@@ -151,10 +157,15 @@ func BuildMessage(atpClient *api.ATPClient, msgData MessageData) (*chat.ConvoSen
 }
 
 func BuildMessageBatch(atpClient *api.ATPClient, msgsData []MessageData) (*chat.ConvoSendMessageBatch_Input, error) {
+	return BuildMessageBatchContext(context.Background(), atpClient, msgsData)
+}
+
+func BuildMessageBatchContext(
+	ctx context.Context, atpClient *api.ATPClient, msgsData []MessageData) (*chat.ConvoSendMessageBatch_Input, error) {
 	var msgItems []*chat.ConvoSendMessageBatch_BatchItem
 
 	for _, msgData := range msgsData {
-		msg, err := BuildMessage(atpClient, msgData)
+		msg, err := BuildMessageContext(ctx, atpClient, msgData)
 		if err != nil {
 			return nil, fmt.Errorf("error building message batch: %w", err)
 		}
@@ -165,7 +176,8 @@ func BuildMessageBatch(atpClient *api.ATPClient, msgsData []MessageData) (*chat.
 	return &chat.ConvoSendMessageBatch_Input{Items: msgItems}, nil
 }
 
-func injectFacets(atpClient *api.ATPClient, text string, mentionInput []*MentionInput) ([]*bsky.RichtextFacet, error) {
+func injectFacets(
+	ctx context.Context, atpClient *api.ATPClient, text string, mentionInput []*MentionInput) ([]*bsky.RichtextFacet, error) {
 	var facets []*bsky.RichtextFacet
 
 	for _, ent := range util.ExtractLinksBytes(text) {
@@ -206,7 +218,7 @@ func injectFacets(atpClient *api.ATPClient, text string, mentionInput []*Mention
 				did = mentionInput[i].Did
 			}
 		} else {
-			respDid, err := atpClient.ResolveHandle(ent.Text)
+			respDid, err := atpClient.ResolveHandleContext(ctx, ent.Text)
 			if err != nil {
 				if atperr.IsInvalidActorDidOrHandleError(err) ||
 					atperr.IsProfileNotFoundError(err) ||
@@ -254,8 +266,13 @@ func injectFacets(atpClient *api.ATPClient, text string, mentionInput []*Mention
 	return facets, nil
 }
 
-func addLink(xrpcc *xrpc.Client, post *bsky.FeedPost, link string) {
-	res, _ := http.Get(link)
+func addLink(ctx context.Context, atpClient *api.ATPClient, post *bsky.FeedPost, link string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return
+	}
+
+	res, _ := atpClient.HTTPClient().Do(req)
 	if res != nil {
 		defer res.Body.Close()
 
@@ -309,18 +326,18 @@ func addLink(xrpcc *xrpc.Client, post *bsky.FeedPost, link string) {
 			}
 		}
 		if imgUrl != "" && post.Embed.EmbedExternal != nil {
-			resp, err := http.Get(imgUrl)
+			var resp *http.Response
+			imgReq, err := http.NewRequestWithContext(ctx, http.MethodGet, imgUrl, nil)
+			if err == nil {
+				resp, err = atpClient.HTTPClient().Do(imgReq)
+			}
 			if err == nil && resp.StatusCode == http.StatusOK {
 				defer resp.Body.Close()
 				b, err := io.ReadAll(resp.Body)
 				if err == nil {
-					blobResp, err := atproto.RepoUploadBlob(context.TODO(), xrpcc, bytes.NewReader(b))
+					blob, err := atpClient.UploadBlobContext(ctx, b)
 					if err == nil {
-						post.Embed.EmbedExternal.External.Thumb = &lexutil.LexBlob{
-							Ref:      blobResp.Blob.Ref,
-							MimeType: http.DetectContentType(b),
-							Size:     blobResp.Blob.Size,
-						}
+						post.Embed.EmbedExternal.External.Thumb = blob
 					}
 				}
 			}
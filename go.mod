@@ -1,12 +1,13 @@
 module github.com/suvpen/suvatp
 
-go 1.22
+go 1.23
 
 require (
 	github.com/PuerkitoBio/goquery v1.9.2
 	github.com/bluesky-social/indigo v0.0.0-20240712235331-7d1235931bd3
 	github.com/kr/pretty v0.2.0
 	github.com/warpfork/go-wish v0.0.0-20220906213052-39a1cc7a02d0
+	golang.org/x/crypto v0.24.0
 	golang.org/x/net v0.26.0
 	golang.org/x/text v0.16.0
 )
@@ -56,7 +57,6 @@ require (
 	go.uber.org/atomic v1.11.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.26.0 // indirect
-	golang.org/x/crypto v0.24.0 // indirect
 	golang.org/x/sys v0.21.0 // indirect
 	golang.org/x/xerrors v0.0.0-20231012003039-104605ab7028 // indirect
 	lukechampine.com/blake3 v1.2.1 // indirect
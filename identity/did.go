@@ -0,0 +1,111 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	DidPlcPrefix = "did:plc:"
+	DidWebPrefix = "did:web:"
+
+	AtprotoPdsServiceId   = "#atproto_pds"
+	AtprotoPdsServiceType = "AtprotoPersonalDataServer"
+)
+
+var ErrUnsupportedDidMethod = errors.New("unsupported DID method")
+
+type VerificationMethod struct {
+	Id                 string `json:"id"`
+	Type               string `json:"type"`
+	Controller         string `json:"controller"`
+	PublicKeyMultibase string `json:"publicKeyMultibase"`
+}
+
+type Service struct {
+	Id              string `json:"id"`
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+type DidDoc struct {
+	Context            []string             `json:"@context"`
+	Id                 string               `json:"id"`
+	AlsoKnownAs        []string             `json:"alsoKnownAs"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod"`
+	Service            []Service            `json:"service"`
+}
+
+// ServiceEndpoint looks a service up by its fragment id (e.g. "#atproto_pds"),
+// accepting both the relative and the DID-qualified form of the id.
+func (doc *DidDoc) ServiceEndpoint(id string) string {
+	for _, service := range doc.Service {
+		if service.Id == id || service.Id == doc.Id+id {
+			return service.ServiceEndpoint
+		}
+	}
+
+	return ""
+}
+
+func (doc *DidDoc) PDSEndpoint() string {
+	for _, service := range doc.Service {
+		if (service.Id == AtprotoPdsServiceId || service.Id == doc.Id+AtprotoPdsServiceId) &&
+			service.Type == AtprotoPdsServiceType {
+			return service.ServiceEndpoint
+		}
+	}
+
+	return ""
+}
+
+// Handle returns the handle claimed in alsoKnownAs, without verifying it.
+func (doc *DidDoc) Handle() string {
+	for _, aka := range doc.AlsoKnownAs {
+		if strings.HasPrefix(aka, "at://") {
+			return strings.ToLower(strings.TrimPrefix(aka, "at://"))
+		}
+	}
+
+	return ""
+}
+
+func IsDid(s string) bool {
+	return strings.HasPrefix(s, "did:")
+}
+
+// ValidateDid accepts the DID methods supported by atproto: did:plc and did:web.
+func ValidateDid(did string) error {
+	switch {
+	case strings.HasPrefix(did, DidPlcPrefix) && len(did) > len(DidPlcPrefix):
+		return nil
+	case strings.HasPrefix(did, DidWebPrefix) && len(did) > len(DidWebPrefix):
+		if _, err := didWebHost(did); err != nil {
+			return err
+		}
+
+		return nil
+	case IsDid(did):
+		return fmt.Errorf("%w: %s", ErrUnsupportedDidMethod, did)
+	default:
+		return fmt.Errorf("invalid DID: %q", did)
+	}
+}
+
+// didWebHost extracts the hostname of a did:web, decoding an optional %3A port.
+// Path-based did:web identifiers are not used by atproto and are rejected.
+func didWebHost(did string) (string, error) {
+	id := strings.TrimPrefix(did, DidWebPrefix)
+	if strings.Contains(id, ":") {
+		return "", fmt.Errorf("invalid did:web %q: paths are not supported", did)
+	}
+
+	host, err := url.PathUnescape(id)
+	if err != nil || host == "" {
+		return "", fmt.Errorf("invalid did:web %q", did)
+	}
+
+	return strings.ToLower(host), nil
+}
@@ -0,0 +1,249 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPLCURL   = "https://plc.directory"
+	DefaultCacheTTL = time.Hour
+
+	maxResponseSize = 1 << 20
+)
+
+var ErrHandleMismatch = errors.New("handle and DID do not point at each other")
+
+type cachedDoc struct {
+	doc     *DidDoc
+	expires time.Time
+}
+
+type cachedDid struct {
+	did     string
+	expires time.Time
+}
+
+// Resolver resolves DIDs to documents and handles to DIDs, caching successful
+// lookups for TTL. The zero value is not usable; create one with NewResolver.
+type Resolver struct {
+	PLCURL     string
+	HTTPClient *http.Client
+	DNS        *net.Resolver
+	TTL        time.Duration
+
+	mu      sync.Mutex
+	docs    map[string]cachedDoc
+	handles map[string]cachedDid
+}
+
+func NewResolver(plcURL string) *Resolver {
+	if plcURL == "" {
+		plcURL = DefaultPLCURL
+	}
+
+	return &Resolver{
+		PLCURL:     strings.TrimSuffix(plcURL, "/"),
+		HTTPClient: &http.Client{Timeout: time.Second * 10},
+		DNS:        net.DefaultResolver,
+		TTL:        DefaultCacheTTL,
+		docs:       make(map[string]cachedDoc),
+		handles:    make(map[string]cachedDid),
+	}
+}
+
+func (resolver *Resolver) ResolveDid(ctx context.Context, did string) (*DidDoc, error) {
+	if err := ValidateDid(did); err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", did, err)
+	}
+
+	resolver.mu.Lock()
+	cached, ok := resolver.docs[did]
+	resolver.mu.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.doc, nil
+	}
+
+	var docUrl string
+	if strings.HasPrefix(did, DidPlcPrefix) {
+		docUrl = resolver.PLCURL + "/" + did
+	} else {
+		host, err := didWebHost(did)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving %s: %w", did, err)
+		}
+
+		docUrl = "https://" + host + "/.well-known/did.json"
+	}
+
+	body, err := resolver.get(ctx, docUrl)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", did, err)
+	}
+
+	var doc *DidDoc
+	if err = json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("error unmarshalling DID document of %s: %w", did, err)
+	}
+
+	if doc.Id != did {
+		return nil, fmt.Errorf("error resolving %s: document is for %s", did, doc.Id)
+	}
+
+	resolver.mu.Lock()
+	resolver.docs[did] = cachedDoc{doc: doc, expires: time.Now().Add(resolver.TTL)}
+	resolver.mu.Unlock()
+
+	return doc, nil
+}
+
+// ResolveHandle looks the handle up through the _atproto DNS TXT record and falls
+// back to https://<handle>/.well-known/atproto-did. The result is not verified
+// against the DID document; use VerifyHandle for that.
+func (resolver *Resolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+
+	resolver.mu.Lock()
+	cached, ok := resolver.handles[handle]
+	resolver.mu.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.did, nil
+	}
+
+	did, dnsErr := resolver.resolveHandleDNS(ctx, handle)
+	if dnsErr != nil {
+		var httpErr error
+		did, httpErr = resolver.resolveHandleHTTPS(ctx, handle)
+		if httpErr != nil {
+			return "", fmt.Errorf("error resolving handle %s: %w", handle, errors.Join(dnsErr, httpErr))
+		}
+	}
+
+	resolver.mu.Lock()
+	resolver.handles[handle] = cachedDid{did: did, expires: time.Now().Add(resolver.TTL)}
+	resolver.mu.Unlock()
+
+	return did, nil
+}
+
+func (resolver *Resolver) resolveHandleDNS(ctx context.Context, handle string) (string, error) {
+	records, err := resolver.DNS.LookupTXT(ctx, "_atproto."+handle)
+	if err != nil {
+		return "", err
+	}
+
+	var did string
+	for _, record := range records {
+		if value, ok := strings.CutPrefix(record, "did="); ok {
+			if did != "" {
+				return "", fmt.Errorf("multiple DIDs published for %s", handle)
+			}
+
+			did = strings.TrimSpace(value)
+		}
+	}
+
+	if err = ValidateDid(did); err != nil {
+		return "", err
+	}
+
+	return did, nil
+}
+
+func (resolver *Resolver) resolveHandleHTTPS(ctx context.Context, handle string) (string, error) {
+	body, err := resolver.get(ctx, "https://"+handle+"/.well-known/atproto-did")
+	if err != nil {
+		return "", err
+	}
+
+	did := strings.TrimSpace(string(body))
+	if err = ValidateDid(did); err != nil {
+		return "", err
+	}
+
+	return did, nil
+}
+
+// VerifyHandle resolves handle and checks that the DID document claims it back.
+func (resolver *Resolver) VerifyHandle(ctx context.Context, handle string) (string, *DidDoc, error) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+
+	did, err := resolver.ResolveHandle(ctx, handle)
+	if err != nil {
+		return "", nil, err
+	}
+
+	doc, err := resolver.ResolveDid(ctx, did)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if doc.Handle() != handle {
+		return "", nil, fmt.Errorf("error verifying handle %s: %w", handle, ErrHandleMismatch)
+	}
+
+	return did, doc, nil
+}
+
+// VerifyDid resolves did and checks that the handle it claims resolves back to it.
+// It returns the verified handle.
+func (resolver *Resolver) VerifyDid(ctx context.Context, did string) (string, *DidDoc, error) {
+	doc, err := resolver.ResolveDid(ctx, did)
+	if err != nil {
+		return "", nil, err
+	}
+
+	handle := doc.Handle()
+	if handle == "" {
+		return "", nil, fmt.Errorf("error verifying %s: %w", did, ErrHandleMismatch)
+	}
+
+	handleDid, err := resolver.ResolveHandle(ctx, handle)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if handleDid != did {
+		return "", nil, fmt.Errorf("error verifying %s: %w", did, ErrHandleMismatch)
+	}
+
+	return handle, doc, nil
+}
+
+// Purge drops any cached entry for a DID or handle.
+func (resolver *Resolver) Purge(didOrHandle string) {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+
+	delete(resolver.docs, didOrHandle)
+	delete(resolver.handles, strings.ToLower(didOrHandle))
+}
+
+func (resolver *Resolver) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := resolver.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %d", url, resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
@@ -0,0 +1,96 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+const callbackPath = "/callback"
+
+// CallbackResult holds the parameters the authorization server redirected with.
+type CallbackResult struct {
+	Code  string
+	State string
+	Iss   string
+}
+
+// LocalCallback listens on a loopback address for the redirect of a CLI login. Use
+// RedirectURI in the client configuration, then Wait for the browser to come back.
+type LocalCallback struct {
+	RedirectURI string
+
+	listener net.Listener
+	server   *http.Server
+	results  chan CallbackResult
+	errs     chan error
+}
+
+// NewLocalCallback listens on addr, e.g. "127.0.0.1:0" for a random free port.
+func NewLocalCallback(addr string) (*LocalCallback, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening for oauth callback: %w", err)
+	}
+
+	callback := &LocalCallback{
+		RedirectURI: "http://" + listener.Addr().String() + callbackPath,
+		listener:    listener,
+		results:     make(chan CallbackResult, 1),
+		errs:        make(chan error, 1),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, callback.handle)
+	callback.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := callback.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			callback.errs <- err
+		}
+	}()
+
+	return callback, nil
+}
+
+func (callback *LocalCallback) handle(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if errCode := query.Get("error"); errCode != "" {
+		http.Error(w, "Sign in failed, you can close this window.", http.StatusBadRequest)
+
+		select {
+		case callback.errs <- &Error{StatusCode: http.StatusBadRequest, Code: errCode, Description: query.Get("error_description")}:
+		default:
+		}
+
+		return
+	}
+
+	_, _ = fmt.Fprintln(w, "Signed in, you can close this window.")
+
+	select {
+	case callback.results <- CallbackResult{Code: query.Get("code"), State: query.Get("state"), Iss: query.Get("iss")}:
+	default:
+	}
+}
+
+// Wait blocks until the redirect arrives or ctx is done, then stops listening.
+func (callback *LocalCallback) Wait(ctx context.Context) (*CallbackResult, error) {
+	defer callback.Close()
+
+	select {
+	case result := <-callback.results:
+		return &result, nil
+	case err := <-callback.errs:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (callback *LocalCallback) Close() error {
+	return callback.server.Close()
+}
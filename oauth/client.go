@@ -0,0 +1,440 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultScope = "atproto transition:generic"
+
+	dpopNonceHeader = "DPoP-Nonce"
+	maxResponseSize = 1 << 20
+)
+
+var (
+	ErrStateMismatch  = errors.New("authorization response state does not match the request")
+	ErrIssuerMismatch = errors.New("authorization server issuer does not match")
+)
+
+// Error is an error response of the authorization server.
+type Error struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("oauth error %d: %s", e.StatusCode, e.Code)
+	}
+
+	return fmt.Sprintf("oauth error %d: %s: %s", e.StatusCode, e.Code, e.Description)
+}
+
+// Config describes the OAuth client. Only public clients, which authenticate with
+// token_endpoint_auth_method "none", are supported.
+type Config struct {
+	ClientID    string
+	RedirectURI string
+	Scope       string
+}
+
+// LoopbackConfig returns the configuration of a loopback client, the client kind
+// atproto authorization servers accept from CLIs without a published client_id.
+func LoopbackConfig(redirectURI, scope string) *Config {
+	if scope == "" {
+		scope = DefaultScope
+	}
+
+	query := url.Values{}
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", scope)
+
+	return &Config{
+		ClientID:    "http://localhost?" + query.Encode(),
+		RedirectURI: redirectURI,
+		Scope:       scope,
+	}
+}
+
+type AuthServerMetadata struct {
+	Issuer                             string   `json:"issuer"`
+	AuthorizationEndpoint              string   `json:"authorization_endpoint"`
+	TokenEndpoint                      string   `json:"token_endpoint"`
+	RevocationEndpoint                 string   `json:"revocation_endpoint,omitempty"`
+	PushedAuthorizationRequestEndpoint string   `json:"pushed_authorization_request_endpoint"`
+	DPoPSigningAlgValuesSupported      []string `json:"dpop_signing_alg_values_supported,omitempty"`
+	// AuthorizationResponseIssParameterSupported servers must send iss with every
+	// authorization response (RFC 9207).
+	AuthorizationResponseIssParameterSupported bool `json:"authorization_response_iss_parameter_supported,omitempty"`
+}
+
+type protectedResourceMetadata struct {
+	Resource             string   `json:"resource"`
+	AuthorizationServers []string `json:"authorization_servers"`
+}
+
+// Client runs the authorization code flow with PKCE, pushed authorization requests
+// and DPoP-bound tokens. Server nonces are remembered per origin.
+type Client struct {
+	Config     *Config
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	nonces map[string]string
+}
+
+func NewClient(config *Config, httpClient *http.Client) *Client {
+	configCopy := *config
+	if configCopy.Scope == "" {
+		configCopy.Scope = DefaultScope
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: time.Second * 10}
+	}
+
+	return &Client{Config: &configCopy, HTTPClient: httpClient, nonces: make(map[string]string)}
+}
+
+func origin(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+func (client *Client) Nonce(rawUrl string) string {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return client.nonces[origin(rawUrl)]
+}
+
+func (client *Client) SetNonce(rawUrl, nonce string) {
+	if nonce == "" {
+		return
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.nonces[origin(rawUrl)] = nonce
+}
+
+func (client *Client) getJSON(ctx context.Context, rawUrl string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", rawUrl, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("error unmarshalling %s: %w", rawUrl, err)
+	}
+
+	return nil
+}
+
+// AuthServerForPDS finds the authorization server of a PDS through its protected
+// resource metadata.
+func (client *Client) AuthServerForPDS(ctx context.Context, pdsEndpoint string) (*AuthServerMetadata, error) {
+	var resource protectedResourceMetadata
+	err := client.getJSON(ctx, strings.TrimSuffix(pdsEndpoint, "/")+"/.well-known/oauth-protected-resource", &resource)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering authorization server of %s: %w", pdsEndpoint, err)
+	}
+
+	if len(resource.AuthorizationServers) == 0 {
+		return nil, fmt.Errorf("error discovering authorization server of %s: none listed", pdsEndpoint)
+	}
+
+	return client.AuthServer(ctx, resource.AuthorizationServers[0])
+}
+
+func (client *Client) AuthServer(ctx context.Context, issuer string) (*AuthServerMetadata, error) {
+	var metadata AuthServerMetadata
+	err := client.getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/oauth-authorization-server", &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error getting metadata of %s: %w", issuer, err)
+	}
+
+	if metadata.Issuer != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrIssuerMismatch, issuer, metadata.Issuer)
+	}
+
+	if metadata.PushedAuthorizationRequestEndpoint == "" || metadata.TokenEndpoint == "" {
+		return nil, fmt.Errorf("authorization server %s does not support pushed authorization requests", issuer)
+	}
+
+	return &metadata, nil
+}
+
+// post sends a DPoP-signed form to the authorization server, retrying once with the
+// nonce the server demands.
+func (client *Client) post(ctx context.Context, endpoint string, form url.Values, dpopKey *DPoPKey, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		proof, err := dpopKey.Proof(http.MethodPost, endpoint, client.Nonce(endpoint), "")
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("DPoP", proof)
+
+		resp, err := client.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		client.SetNonce(endpoint, resp.Header.Get(dpopNonceHeader))
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			if out == nil {
+				return nil
+			}
+
+			return json.Unmarshal(body, out)
+		}
+
+		oauthErr := &Error{StatusCode: resp.StatusCode}
+		_ = json.Unmarshal(body, oauthErr)
+
+		if oauthErr.Code == "use_dpop_nonce" && attempt == 0 {
+			continue
+		}
+
+		return oauthErr
+	}
+}
+
+// AuthRequest is a pending authorization, kept between StartAuthorization and Exchange.
+type AuthRequest struct {
+	AuthorizationURL string
+	State            string
+
+	Server   *AuthServerMetadata
+	Verifier string
+	DPoPKey  *DPoPKey
+}
+
+func randomString() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return b64(data), nil
+}
+
+// StartAuthorization pushes an authorization request and returns the URL the user
+// has to open. loginHint, a handle or DID, is optional.
+func (client *Client) StartAuthorization(
+	ctx context.Context, server *AuthServerMetadata, loginHint string) (*AuthRequest, error) {
+	dpopKey, err := GenerateDPoPKey()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	form := url.Values{}
+	form.Set("client_id", client.Config.ClientID)
+	form.Set("response_type", "code")
+	form.Set("redirect_uri", client.Config.RedirectURI)
+	form.Set("scope", client.Config.Scope)
+	form.Set("state", state)
+	form.Set("code_challenge", b64(challenge[:]))
+	form.Set("code_challenge_method", "S256")
+	if loginHint != "" {
+		form.Set("login_hint", loginHint)
+	}
+
+	var par struct {
+		RequestURI string `json:"request_uri"`
+	}
+	if err = client.post(ctx, server.PushedAuthorizationRequestEndpoint, form, dpopKey, &par); err != nil {
+		return nil, fmt.Errorf("error pushing authorization request: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("client_id", client.Config.ClientID)
+	query.Set("request_uri", par.RequestURI)
+
+	return &AuthRequest{
+		AuthorizationURL: server.AuthorizationEndpoint + "?" + query.Encode(),
+		State:            state,
+		Server:           server,
+		Verifier:         verifier,
+		DPoPKey:          dpopKey,
+	}, nil
+}
+
+type TokenSet struct {
+	AccessToken  string
+	RefreshToken string
+	Scope        string
+	Sub          string
+	ExpiresAt    time.Time
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	Sub          string `json:"sub"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func (resp *tokenResponse) tokenSet() (*TokenSet, error) {
+	if !strings.EqualFold(resp.TokenType, "DPoP") {
+		return nil, fmt.Errorf("unexpected token type %q", resp.TokenType)
+	}
+
+	return &TokenSet{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		Scope:        resp.Scope,
+		Sub:          resp.Sub,
+		ExpiresAt:    time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// Exchange redeems the code of the authorization response. state and iss are the
+// parameters the redirect URI was called with; iss may only be empty if the server
+// does not advertise sending it.
+func (client *Client) Exchange(ctx context.Context, request *AuthRequest, code, state, iss string) (*TokenSet, error) {
+	if state != request.State {
+		return nil, ErrStateMismatch
+	}
+
+	if iss == "" && request.Server.AuthorizationResponseIssParameterSupported {
+		return nil, fmt.Errorf("%w: expected %s, got no iss", ErrIssuerMismatch, request.Server.Issuer)
+	}
+
+	if iss != "" && iss != request.Server.Issuer {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrIssuerMismatch, request.Server.Issuer, iss)
+	}
+
+	form := url.Values{}
+	form.Set("client_id", client.Config.ClientID)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", client.Config.RedirectURI)
+	form.Set("code_verifier", request.Verifier)
+
+	var resp tokenResponse
+	if err := client.post(ctx, request.Server.TokenEndpoint, form, request.DPoPKey, &resp); err != nil {
+		return nil, fmt.Errorf("error exchanging authorization code: %w", err)
+	}
+
+	return resp.tokenSet()
+}
+
+func (client *Client) Refresh(
+	ctx context.Context, tokenEndpoint, refreshToken string, dpopKey *DPoPKey) (*TokenSet, error) {
+	form := url.Values{}
+	form.Set("client_id", client.Config.ClientID)
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+
+	var resp tokenResponse
+	if err := client.post(ctx, tokenEndpoint, form, dpopKey, &resp); err != nil {
+		return nil, fmt.Errorf("error refreshing token: %w", err)
+	}
+
+	return resp.tokenSet()
+}
+
+func (client *Client) Revoke(ctx context.Context, revocationEndpoint, token string, dpopKey *DPoPKey) error {
+	form := url.Values{}
+	form.Set("client_id", client.Config.ClientID)
+	form.Set("token", token)
+
+	if err := client.post(ctx, revocationEndpoint, form, dpopKey, nil); err != nil {
+		return fmt.Errorf("error revoking token: %w", err)
+	}
+
+	return nil
+}
+
+// Session is what a client needs to keep using and refreshing DPoP-bound tokens
+// after the authorization flow; it is persisted alongside the tokens.
+type Session struct {
+	Issuer             string    `json:"issuer"`
+	ClientID           string    `json:"client_id"`
+	RedirectURI        string    `json:"redirect_uri"`
+	Scope              string    `json:"scope"`
+	TokenEndpoint      string    `json:"token_endpoint"`
+	RevocationEndpoint string    `json:"revocation_endpoint,omitempty"`
+	DPoPKey            *DPoPKey  `json:"dpop_key"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+func NewSession(client *Client, request *AuthRequest, tokens *TokenSet) *Session {
+	return &Session{
+		Issuer:             request.Server.Issuer,
+		ClientID:           client.Config.ClientID,
+		RedirectURI:        client.Config.RedirectURI,
+		Scope:              tokens.Scope,
+		TokenEndpoint:      request.Server.TokenEndpoint,
+		RevocationEndpoint: request.Server.RevocationEndpoint,
+		DPoPKey:            request.DPoPKey,
+		ExpiresAt:          tokens.ExpiresAt,
+	}
+}
+
+// Client returns an OAuth client able to refresh and revoke the session's tokens.
+func (session *Session) Client(httpClient *http.Client) *Client {
+	return NewClient(
+		&Config{ClientID: session.ClientID, RedirectURI: session.RedirectURI, Scope: session.Scope}, httpClient)
+}
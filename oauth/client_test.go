@@ -0,0 +1,450 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	testSub         = "did:plc:testaccount"
+	testCode        = "code-1"
+	testRequestURI  = "urn:ietf:params:oauth:request_uri:req-1"
+	testRedirectURI = "http://127.0.0.1:8080/callback"
+)
+
+// testAuthServer is a stand-in atproto authorization server that also serves the
+// protected resource metadata of its PDS. It demands a DPoP nonce, checks the PKCE
+// challenge and binds the tokens to the key of the pushed authorization request.
+type testAuthServer struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	nonce          string
+	metadataIssuer string
+	issSupported   bool
+	par            url.Values
+	parKey         string
+
+	parRequests   atomic.Int64
+	tokenRequests atomic.Int64
+}
+
+func newTestAuthServer(t *testing.T) *testAuthServer {
+	t.Helper()
+
+	server := &testAuthServer{nonce: "nonce-1", issSupported: true}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-protected-resource", server.protectedResource)
+	mux.HandleFunc("/.well-known/oauth-authorization-server", server.metadata)
+	mux.HandleFunc("/oauth/par", server.pushedAuthorizationRequest)
+	mux.HandleFunc("/oauth/token", server.token)
+
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (server *testAuthServer) setNonce(nonce string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.nonce = nonce
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func (server *testAuthServer) protectedResource(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, protectedResourceMetadata{
+		Resource:             server.URL,
+		AuthorizationServers: []string{server.URL},
+	})
+}
+
+func (server *testAuthServer) metadata(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	issuer := server.metadataIssuer
+	issSupported := server.issSupported
+	server.mu.Unlock()
+
+	if issuer == "" {
+		issuer = server.URL
+	}
+
+	writeJSON(w, http.StatusOK, AuthServerMetadata{
+		Issuer:                                     issuer,
+		AuthorizationEndpoint:                      server.URL + "/oauth/authorize",
+		TokenEndpoint:                              server.URL + "/oauth/token",
+		PushedAuthorizationRequestEndpoint:         server.URL + "/oauth/par",
+		DPoPSigningAlgValuesSupported:              []string{"ES256"},
+		AuthorizationResponseIssParameterSupported: issSupported,
+	})
+}
+
+// verifyProof checks the DPoP proof of r and returns the x coordinate of its key.
+// It writes the error response itself when the proof is refused.
+func (server *testAuthServer) verifyProof(w http.ResponseWriter, r *http.Request) (string, bool) {
+	server.mu.Lock()
+	nonce := server.nonce
+	server.mu.Unlock()
+
+	w.Header().Set(dpopNonceHeader, nonce)
+
+	var header struct {
+		Typ string `json:"typ"`
+		Alg string `json:"alg"`
+		JWK jwk    `json:"jwk"`
+	}
+	var claims struct {
+		Htm   string `json:"htm"`
+		Htu   string `json:"htu"`
+		Nonce string `json:"nonce"`
+	}
+
+	parts := strings.Split(r.Header.Get("DPoP"), ".")
+	if len(parts) != 3 || decodeSegment(parts[0], &header) != nil || decodeSegment(parts[1], &claims) != nil ||
+		header.Typ != "dpop+jwt" || header.Alg != "ES256" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", "malformed proof")
+		return "", false
+	}
+
+	x, xErr := base64.RawURLEncoding.DecodeString(header.JWK.X)
+	y, yErr := base64.RawURLEncoding.DecodeString(header.JWK.Y)
+	signature, sigErr := base64.RawURLEncoding.DecodeString(parts[2])
+	if xErr != nil || yErr != nil || sigErr != nil || len(signature) != 64 {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", "malformed key or signature")
+		return "", false
+	}
+
+	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(publicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", "bad signature")
+		return "", false
+	}
+
+	if claims.Htm != r.Method || claims.Htu != server.URL+r.URL.Path {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", "proof is for another request")
+		return "", false
+	}
+
+	if claims.Nonce != nonce {
+		writeOAuthError(w, http.StatusBadRequest, "use_dpop_nonce", "Authorization server requires nonce in DPoP proof")
+		return "", false
+	}
+
+	return header.JWK.X, true
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func (server *testAuthServer) pushedAuthorizationRequest(w http.ResponseWriter, r *http.Request) {
+	server.parRequests.Add(1)
+
+	keyX, ok := server.verifyProof(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if r.PostForm.Get("response_type") != "code" || r.PostForm.Get("code_challenge_method") != "S256" ||
+		r.PostForm.Get("code_challenge") == "" || r.PostForm.Get("state") == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "PKCE and state are required")
+		return
+	}
+
+	server.mu.Lock()
+	server.par = r.PostForm
+	server.parKey = keyX
+	server.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"request_uri": testRequestURI, "expires_in": 60})
+}
+
+func (server *testAuthServer) token(w http.ResponseWriter, r *http.Request) {
+	server.tokenRequests.Add(1)
+
+	keyX, ok := server.verifyProof(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	server.mu.Lock()
+	par, parKey := server.par, server.parKey
+	server.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != testCode:
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "unknown code")
+	case par == nil || b64(verifier[:]) != par.Get("code_challenge"):
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match code_challenge")
+	case r.PostForm.Get("redirect_uri") != par.Get("redirect_uri") || r.PostForm.Get("client_id") != par.Get("client_id"):
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "client does not match the authorization request")
+	case keyX != parKey:
+		writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", "key does not match the authorization request")
+	default:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token":  "access-1",
+			"token_type":    "DPoP",
+			"refresh_token": "refresh-1",
+			"scope":         DefaultScope,
+			"sub":           testSub,
+			"expires_in":    3600,
+		})
+	}
+}
+
+func newTestClient() *Client {
+	return NewClient(LoopbackConfig(testRedirectURI, ""), nil)
+}
+
+func startTestAuthorization(t *testing.T, server *testAuthServer, client *Client) *AuthRequest {
+	t.Helper()
+
+	metadata, err := client.AuthServerForPDS(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("discovering authorization server: %v", err)
+	}
+
+	request, err := client.StartAuthorization(context.Background(), metadata, testSub)
+	if err != nil {
+		t.Fatalf("starting authorization: %v", err)
+	}
+
+	return request
+}
+
+func TestAuthServerForPDS(t *testing.T) {
+	server := newTestAuthServer(t)
+
+	metadata, err := newTestClient().AuthServerForPDS(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("discovering authorization server: %v", err)
+	}
+
+	if metadata.Issuer != server.URL {
+		t.Errorf("issuer = %s, want %s", metadata.Issuer, server.URL)
+	}
+	if metadata.PushedAuthorizationRequestEndpoint != server.URL+"/oauth/par" {
+		t.Errorf("PAR endpoint = %s", metadata.PushedAuthorizationRequestEndpoint)
+	}
+	if !metadata.AuthorizationResponseIssParameterSupported {
+		t.Error("iss parameter support was not read")
+	}
+}
+
+func TestAuthServerRejectsIssuerMismatch(t *testing.T) {
+	server := newTestAuthServer(t)
+	server.metadataIssuer = "https://auth.example.com"
+
+	_, err := newTestClient().AuthServerForPDS(context.Background(), server.URL)
+	if !errors.Is(err, ErrIssuerMismatch) {
+		t.Fatalf("err = %v, want %v", err, ErrIssuerMismatch)
+	}
+}
+
+func TestStartAuthorization(t *testing.T) {
+	server := newTestAuthServer(t)
+	client := newTestClient()
+
+	request := startTestAuthorization(t, server, client)
+
+	// the first push is refused for lacking the nonce, the second carries it
+	if got := server.parRequests.Load(); got != 2 {
+		t.Errorf("PAR requests = %d, want 2", got)
+	}
+	if got := client.Nonce(server.URL + "/oauth/par"); got != "nonce-1" {
+		t.Errorf("nonce = %q, want nonce-1", got)
+	}
+
+	challenge := sha256.Sum256([]byte(request.Verifier))
+	if got := server.par.Get("code_challenge"); got != b64(challenge[:]) {
+		t.Errorf("code_challenge = %s, want the S256 hash of the verifier", got)
+	}
+	if got := server.par.Get("state"); got != request.State {
+		t.Errorf("state = %s, want %s", got, request.State)
+	}
+	if got := server.par.Get("login_hint"); got != testSub {
+		t.Errorf("login_hint = %s, want %s", got, testSub)
+	}
+	if got := server.par.Get("redirect_uri"); got != testRedirectURI {
+		t.Errorf("redirect_uri = %s, want %s", got, testRedirectURI)
+	}
+
+	authorizationURL, err := url.Parse(request.AuthorizationURL)
+	if err != nil {
+		t.Fatalf("parsing authorization URL: %v", err)
+	}
+	if authorizationURL.Path != "/oauth/authorize" {
+		t.Errorf("authorization URL path = %s", authorizationURL.Path)
+	}
+	if got := authorizationURL.Query().Get("request_uri"); got != testRequestURI {
+		t.Errorf("request_uri = %s, want %s", got, testRequestURI)
+	}
+	if got := authorizationURL.Query().Get("client_id"); got != client.Config.ClientID {
+		t.Errorf("client_id = %s, want %s", got, client.Config.ClientID)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	server := newTestAuthServer(t)
+	client := newTestClient()
+
+	request := startTestAuthorization(t, server, client)
+
+	// a rotated nonce makes the token endpoint ask for a retry as well
+	server.setNonce("nonce-2")
+
+	tokens, err := client.Exchange(context.Background(), request, testCode, request.State, server.URL)
+	if err != nil {
+		t.Fatalf("exchanging code: %v", err)
+	}
+
+	if got := server.tokenRequests.Load(); got != 2 {
+		t.Errorf("token requests = %d, want 2", got)
+	}
+	if tokens.AccessToken != "access-1" || tokens.RefreshToken != "refresh-1" {
+		t.Errorf("tokens = %s/%s", tokens.AccessToken, tokens.RefreshToken)
+	}
+	if tokens.Sub != testSub {
+		t.Errorf("sub = %s, want %s", tokens.Sub, testSub)
+	}
+	if tokens.ExpiresAt.IsZero() {
+		t.Error("expiry was not set")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	server := newTestAuthServer(t)
+	client := newTestClient()
+
+	request := startTestAuthorization(t, server, client)
+	request.Verifier = "not-the-verifier"
+
+	_, err := client.Exchange(context.Background(), request, testCode, request.State, server.URL)
+
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("err = %v, want invalid_grant", err)
+	}
+}
+
+func TestExchangeRejectsOtherDPoPKey(t *testing.T) {
+	server := newTestAuthServer(t)
+	client := newTestClient()
+
+	request := startTestAuthorization(t, server, client)
+
+	otherKey, err := GenerateDPoPKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.DPoPKey = otherKey
+
+	_, err = client.Exchange(context.Background(), request, testCode, request.State, server.URL)
+
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_dpop_proof" {
+		t.Fatalf("err = %v, want invalid_dpop_proof", err)
+	}
+}
+
+func TestExchangeChecksResponseParameters(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        func(request *AuthRequest) string
+		iss          func(server *testAuthServer) string
+		issSupported bool
+		want         error
+	}{
+		{
+			name:         "state mismatch",
+			state:        func(*AuthRequest) string { return "forged" },
+			iss:          func(server *testAuthServer) string { return server.URL },
+			issSupported: true,
+			want:         ErrStateMismatch,
+		},
+		{
+			name:         "issuer mismatch",
+			state:        func(request *AuthRequest) string { return request.State },
+			iss:          func(*testAuthServer) string { return "https://auth.example.com" },
+			issSupported: true,
+			want:         ErrIssuerMismatch,
+		},
+		{
+			name:         "issuer missing although advertised",
+			state:        func(request *AuthRequest) string { return request.State },
+			iss:          func(*testAuthServer) string { return "" },
+			issSupported: true,
+			want:         ErrIssuerMismatch,
+		},
+		{
+			name:  "issuer missing and not advertised",
+			state: func(request *AuthRequest) string { return request.State },
+			iss:   func(*testAuthServer) string { return "" },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestAuthServer(t)
+			server.issSupported = test.issSupported
+			client := newTestClient()
+
+			request := startTestAuthorization(t, server, client)
+
+			_, err := client.Exchange(context.Background(), request, testCode, test.state(request), test.iss(server))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+
+			// refused responses must not reach the token endpoint
+			wantTokenRequests := int64(1)
+			if test.want != nil {
+				wantTokenRequests = 0
+			}
+			if got := server.tokenRequests.Load(); got != wantTokenRequests {
+				t.Errorf("token requests = %d, want %d", got, wantTokenRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package oauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// DPoPKey is the ES256 key that access and refresh tokens of a session are bound to.
+// It marshals to a private JWK so it can be persisted with the session.
+type DPoPKey struct {
+	key *ecdsa.PrivateKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	D   string `json:"d,omitempty"`
+}
+
+func GenerateDPoPKey() (*DPoPKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating DPoP key: %w", err)
+	}
+
+	return &DPoPKey{key: key}, nil
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (dpopKey *DPoPKey) publicJWK() jwk {
+	return jwk{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   b64(dpopKey.key.X.FillBytes(make([]byte, 32))),
+		Y:   b64(dpopKey.key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func (dpopKey *DPoPKey) MarshalJSON() ([]byte, error) {
+	private := dpopKey.publicJWK()
+	private.D = b64(dpopKey.key.D.FillBytes(make([]byte, 32)))
+
+	return json.Marshal(private)
+}
+
+func (dpopKey *DPoPKey) UnmarshalJSON(data []byte) error {
+	var private jwk
+	if err := json.Unmarshal(data, &private); err != nil {
+		return err
+	}
+
+	if private.Kty != "EC" || private.Crv != "P-256" {
+		return fmt.Errorf("unsupported DPoP key %s/%s", private.Kty, private.Crv)
+	}
+
+	var coordinates [3]*big.Int
+	for i, value := range []string{private.X, private.Y, private.D} {
+		decoded, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("error decoding DPoP key: %w", err)
+		}
+
+		coordinates[i] = new(big.Int).SetBytes(decoded)
+	}
+
+	dpopKey.key = &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: coordinates[0], Y: coordinates[1]},
+		D:         coordinates[2],
+	}
+
+	return nil
+}
+
+// Proof creates the DPoP header value for a request. accessToken is set when calling
+// a resource server, so the proof is bound to the token through the ath claim.
+func (dpopKey *DPoPKey) Proof(method, requestUrl, nonce, accessToken string) (string, error) {
+	htu, err := url.Parse(requestUrl)
+	if err != nil {
+		return "", fmt.Errorf("error parsing %s: %w", requestUrl, err)
+	}
+	htu.RawQuery = ""
+	htu.Fragment = ""
+
+	jti := make([]byte, 16)
+	if _, err = rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	header := map[string]interface{}{
+		"typ": "dpop+jwt",
+		"alg": "ES256",
+		"jwk": dpopKey.publicJWK(),
+	}
+
+	claims := map[string]interface{}{
+		"jti": b64(jti),
+		"htm": method,
+		"htu": htu.String(),
+		"iat": time.Now().Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if accessToken != "" {
+		ath := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = b64(ath[:])
+	}
+
+	return dpopKey.sign(header, claims)
+}
+
+func (dpopKey *DPoPKey) sign(header, claims map[string]interface{}) (string, error) {
+	headerJson, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	claimsJson, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64(headerJson) + "." + b64(claimsJson)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, s, err := ecdsa.Sign(rand.Reader, dpopKey.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing DPoP proof: %w", err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signingInput + "." + b64(signature), nil
+}
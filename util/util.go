@@ -36,6 +36,14 @@ func CreateBskyPostURL(didOrHandle, rkey string) string {
 	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", didOrHandle, rkey)
 }
 
+func CreateBskyStarterPackURL(didOrHandle, rkey string) string {
+	if didOrHandle == "" || rkey == "" {
+		return "-"
+	}
+
+	return fmt.Sprintf("https://bsky.app/starter-pack/%s/%s", didOrHandle, rkey)
+}
+
 func GetHandleFromURL(atpUrl string) string {
 	atpUrl = strings.Replace(atpUrl, "@", "", -1)
 	atpUrl = strings.Split(strings.ToLower(atpUrl), "?")[0]